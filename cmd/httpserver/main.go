@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/iferdel-vault/tcptohttp/internal/request"
 	"github.com/iferdel-vault/tcptohttp/internal/response"
@@ -20,33 +22,53 @@ import (
 
 const port = 42069
 
+// shutdownTimeout is how long in-flight responses get to finish on exit.
+const shutdownTimeout = 30 * time.Second
+
+var (
+	assets      = os.DirFS("assets")
+	assetServer = server.FileServer(assets, server.FileServerOptions{
+		StripPrefix:     "/assets",
+		ListDirectories: true,
+	})
+)
+
 func main() {
-	server, err := server.Serve(port, handler)
+	server, err := server.Serve(port, server.Compress(handler))
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error stopping server: %v", err)
+		return
+	}
 	log.Println("Server gracefully stopped")
 }
 
 func handler(w *response.Writer, r *request.Request) {
-	target := r.RequestLine.RequestTarget
+	path := r.RequestLine.Target.Path
 	switch {
-	case target == "/video":
-		videoHandler(w, r)
+	case path == "/video":
+		server.ServeFile(w, r, assets, "vim.mp4")
 		return
-	case strings.HasPrefix(target, "/httpbin"):
+	case path == "/assets" || strings.HasPrefix(path, "/assets/"):
+		assetServer(w, r)
+		return
+	case path == "/httpbin" || strings.HasPrefix(path, "/httpbin/"):
 		proxyHandler(w, r)
 		return
-	case target == "/yourproblem":
+	case path == "/yourproblem":
 		handler400(w, r)
 		return
-	case target == "/myproblem":
+	case path == "/myproblem":
 		handler500(w, r)
 		return
 	default:
@@ -56,7 +78,6 @@ func handler(w *response.Writer, r *request.Request) {
 }
 
 func handler400(w *response.Writer, _ *request.Request) {
-	w.WriteStatusLine(response.StatusBadRequest)
 	body := []byte(`
 <html>
   <head>
@@ -68,14 +89,12 @@ func handler400(w *response.Writer, _ *request.Request) {
   </body>
 </html>
 `)
-	headers := response.GetDefaultHeaders(len(body))
-	headers.Override("Content-Type", "text/html")
-	w.WriteHeaders(headers)
-	w.WriteBody(body)
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(response.StatusBadRequest)
+	w.Write(body)
 }
 
 func handler500(w *response.Writer, _ *request.Request) {
-	w.WriteStatusLine(response.StatusInternalServerError)
 	body := []byte(`
 <html>
   <head>
@@ -87,14 +106,12 @@ func handler500(w *response.Writer, _ *request.Request) {
   </body>
 </html>
 `)
-	headers := response.GetDefaultHeaders(len(body))
-	headers.Override("Content-Type", "text/html")
-	w.WriteHeaders(headers)
-	w.WriteBody(body)
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(response.StatusInternalServerError)
+	w.Write(body)
 }
 
-func handler200(w *response.Writer, _ *request.Request) {
-	w.WriteStatusLine(response.StatusOK)
+func handler200(w *response.Writer, r *request.Request) {
 	body := []byte(`
 <html>
   <head>
@@ -106,15 +123,20 @@ func handler200(w *response.Writer, _ *request.Request) {
   </body>
 </html>
 `)
-	headers := response.GetDefaultHeaders(len(body))
-	headers.Override("Content-Type", "text/html")
-	w.WriteHeaders(headers)
-	w.WriteBody(body)
+	w.Header().Set("Content-Type", "text/html")
+	if server.CheckPreconditions(w, r, server.StrongETag(body), time.Time{}) {
+		return
+	}
+	w.WriteHeader(response.StatusOK)
+	w.Write(body)
 }
 
 func proxyHandler(w *response.Writer, r *request.Request) {
-	target := strings.TrimPrefix(r.RequestLine.RequestTarget, "/httpbin/")
-	url := "https://httpbin.org/" + target
+	target := r.RequestLine.Target
+	url := "https://httpbin.org/" + strings.TrimPrefix(strings.TrimPrefix(target.RawPath, "/httpbin"), "/")
+	if target.RawQuery != "" {
+		url += "?" + target.RawQuery
+	}
 	fmt.Println("Proxying to", url)
 	resp, err := http.Get(url)
 	if err != nil {
@@ -125,8 +147,8 @@ func proxyHandler(w *response.Writer, r *request.Request) {
 
 	w.WriteStatusLine(response.StatusOK)
 	h := response.GetDefaultHeaders(0)
-	h.Override("Transfer-Encoding", "chunked")
-	h.Remove("Content-Length")
+	h.Set("Transfer-Encoding", "chunked")
+	h.Del("Content-Length")
 	h.Set("Trailer", "X-Content-SHA256, X-Content-Length")
 	w.WriteHeaders(h)
 
@@ -139,6 +161,9 @@ func proxyHandler(w *response.Writer, r *request.Request) {
 		fmt.Println("Read", n, "bytes")
 		if n > 0 {
 			_, err := w.WriteChunkedBody(buffer[:n])
+			if err == nil {
+				err = w.Flush()
+			}
 			if err != nil {
 				fmt.Println("Error writing chunked body:", err)
 				break
@@ -161,7 +186,7 @@ func proxyHandler(w *response.Writer, r *request.Request) {
 	}
 
 	th := response.GetDefaultHeaders(0)
-	th.Remove("Content-Length")
+	th.Del("Content-Length")
 	checksum := sha256.Sum256(b)
 	hashString := hex.EncodeToString(checksum[:])
 	th.Set("X-Content-Sha256", hashString)
@@ -171,18 +196,3 @@ func proxyHandler(w *response.Writer, r *request.Request) {
 		fmt.Println("Error writing trailers:", err)
 	}
 }
-
-func videoHandler(w *response.Writer, r *request.Request) {
-	dat, err := os.ReadFile("assets/vim.mp4")
-	if err != nil {
-		fmt.Println("error reading static video file:", err)
-		handler500(w, r)
-		return
-	}
-
-	w.WriteStatusLine(response.StatusOK)
-	h := response.GetDefaultHeaders(len(dat))
-	h.Override("Content-Type", "video/mp4")
-	w.WriteHeaders(h)
-	w.WriteBody(dat)
-}
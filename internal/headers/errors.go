@@ -0,0 +1,18 @@
+package headers
+
+// Error is a field line parse failure. StatusCode is the response status
+// the failure maps to.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	ErrMalformedFieldLine = &Error{StatusCode: 400, Message: "malformed field line"}
+	ErrInvalidHeaderName  = &Error{StatusCode: 400, Message: "invalid header name"}
+	ErrInvalidHeaderValue = &Error{StatusCode: 400, Message: "invalid header value"}
+)
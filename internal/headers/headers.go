@@ -3,16 +3,27 @@ package headers
 import (
 	"bytes"
 	"fmt"
+	"iter"
 	"strings"
-	"unicode"
 )
 
 const crlf = "\r\n"
 
-type Headers map[string]string
+// Field is a single field line. Name keeps the casing it was sent or set
+// with.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Headers keeps every field line in the order it was added. Names are
+// matched case-insensitively.
+type Headers struct {
+	fields []Field
+}
 
-func NewHeaders() Headers {
-	return Headers{}
+func NewHeaders() *Headers {
+	return &Headers{}
 }
 
 func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
@@ -26,58 +37,189 @@ func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
 	}
 
 	parts := bytes.SplitN(data[:idx], []byte(":"), 2)
-	key := strings.ToLower(string(parts[0]))
+	if len(parts) != 2 {
+		return 0, false, fmt.Errorf("%w: missing colon: %q", ErrMalformedFieldLine, data[:idx])
+	}
+	key := string(parts[0])
 
-	if key != strings.TrimRight(key, " ") {
-		return 0, false, fmt.Errorf("invalid header name: %s", key)
+	if key == "" || isWhitespace(key[len(key)-1]) {
+		// RFC 9112 §5.1: no whitespace between the name and the colon
+		return 0, false, fmt.Errorf("%w: %q", ErrInvalidHeaderName, key)
 	}
-	if key == "" {
-		return 0, false, fmt.Errorf("invalid header name: %s", key)
+	if h.Len() > 0 && isWhitespace(key[0]) {
+		// RFC 9112 §5.2: obs-fold, which a front end may join to the
+		// previous field instead
+		return 0, false, fmt.Errorf("%w: obsolete line folding: %q", ErrMalformedFieldLine, data[:idx])
 	}
 
-	value := bytes.TrimSpace(parts[1])
-	key = strings.TrimSpace(key)
-
-	allowedSpecials := "!#$%&'*+-.^_`|~"
-	for _, c := range key {
-		if !unicode.IsDigit(c) && !unicode.IsLetter(c) && !strings.ContainsRune(allowedSpecials, c) {
-			return 0, false, fmt.Errorf("header key contains unaccepted characters: %q", c)
-		}
-	}
+	// only SP and HTAB are optional whitespace; anything else is checked
+	value := bytes.Trim(parts[1], " \t")
+	key = strings.TrimLeft(key, " \t")
 
 	if len(strings.Split(key, " ")) > 1 {
-		return 0, false, fmt.Errorf("malformed key on header with extra space internally in the key: %s", key)
+		return 0, false, fmt.Errorf("%w: extra space internally in the key: %s", ErrInvalidHeaderName, key)
 	}
 
-	err = h.Set(key, string(value))
+	err = h.Add(key, string(value))
 	if err != nil {
 		return 0, false, err
 	}
 	return idx + len(crlf), false, nil
 }
 
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// Add appends a field line, keeping any existing ones with the same name.
+func (h *Headers) Add(key, value string) error {
+	err := CheckField(key, value)
+	if err != nil {
+		return err
+	}
+	h.fields = append(h.fields, Field{Name: key, Value: value})
+	return nil
+}
+
+// Set replaces every field line named key with a single one, which takes
+// the place of the first.
 func (h *Headers) Set(key, value string) error {
-	key = strings.ToLower(key)
-	if val, ok := (*h)[key]; ok {
-		(*h)[key] = fmt.Sprintf("%s, %s", val, value)
-		return nil
+	err := CheckField(key, value)
+	if err != nil {
+		return err
+	}
+	for i, f := range h.fields {
+		if strings.EqualFold(f.Name, key) {
+			h.fields[i] = Field{Name: key, Value: value}
+			h.delFrom(i+1, key)
+			return nil
+		}
+	}
+	return h.Add(key, value)
+}
+
+// Get returns the values of every field line named key combined into one
+// comma-separated list, as RFC 9110 §5.3 allows for most fields. Use Values
+// for fields such as Set-Cookie that cannot be combined.
+func (h *Headers) Get(key string) (string, bool) {
+	values := h.Values(key)
+	if len(values) == 0 {
+		return "", false
+	}
+	return strings.Join(values, ", "), true
+}
+
+// Values returns the value of every field line named key in order.
+func (h *Headers) Values(key string) []string {
+	var values []string
+	for _, f := range h.fields {
+		if strings.EqualFold(f.Name, key) {
+			values = append(values, f.Value)
+		}
+	}
+	return values
+}
+
+// Del removes every field line named key.
+func (h *Headers) Del(key string) {
+	h.delFrom(0, key)
+}
+
+func (h *Headers) delFrom(start int, key string) {
+	kept := h.fields[:start]
+	for _, f := range h.fields[start:] {
+		if !strings.EqualFold(f.Name, key) {
+			kept = append(kept, f)
+		}
+	}
+	clear(h.fields[len(kept):])
+	h.fields = kept
+}
+
+// Len returns the number of field lines.
+func (h *Headers) Len() int {
+	return len(h.fields)
+}
+
+// All iterates over the field lines in order.
+func (h *Headers) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for _, f := range h.fields {
+			if !yield(f.Name, f.Value) {
+				return
+			}
+		}
+	}
+}
+
+// HasToken reports whether the comma-separated lists in the key fields
+// contain token, compared case-insensitively.
+func (h *Headers) HasToken(key, token string) bool {
+	for _, v := range h.Values(key) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckField reports whether key and value can be sent as a field line.
+// The name must be a token (RFC 9110 §5.1) and the value must not contain
+// control characters other than HTAB (RFC 9110 §5.5), which rules out CR,
+// LF and NUL. Bytes from 0x80 up (obs-text) are allowed and passed through.
+func CheckField(key, value string) error {
+	if key == "" {
+		return fmt.Errorf("%w: empty name", ErrInvalidHeaderName)
+	}
+	for i := 0; i < len(key); i++ {
+		if !isTokenChar(key[i]) {
+			return fmt.Errorf("%w: contains unaccepted character: %q", ErrInvalidHeaderName, key[i])
+		}
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c < 0x20 && c != '\t') || c == 0x7f {
+			return fmt.Errorf("%w: contains control character %q in %s", ErrInvalidHeaderValue, c, key)
+		}
 	}
-	(*h)[key] = value
 	return nil
 }
 
-func (h Headers) Get(key string) (string, bool) {
-	key = strings.ToLower(key)
-	v, ok := h[key]
-	return v, ok
+// CanonicalName returns key with the first letter and every letter after a
+// hyphen upper-cased and the rest lower-cased, so "content-type" becomes
+// "Content-Type".
+func CanonicalName(key string) string {
+	b := []byte(key)
+	upper := true
+	for i, c := range b {
+		switch {
+		case upper && 'a' <= c && c <= 'z':
+			b[i] = c - ('a' - 'A')
+		case !upper && 'A' <= c && c <= 'Z':
+			b[i] = c + ('a' - 'A')
+		}
+		upper = c == '-'
+	}
+	return string(b)
 }
 
-func (h Headers) Override(key, value string) {
-	key = strings.ToLower(key)
-	h[key] = value
+// IsToken reports whether s is a token as defined in RFC 9110 §5.6.2, the
+// syntax of field names and of many values and parameters.
+func IsToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTokenChar(s[i]) {
+			return false
+		}
+	}
+	return true
 }
 
-func (h Headers) Remove(key string) {
-	key = strings.ToLower(key)
-	delete(h, key)
+func isTokenChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
 }
@@ -14,7 +14,7 @@ func TestHeadersParse(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headerValue(headers, "host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -24,18 +24,19 @@ func TestHeadersParse(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", headerValue(headers, "host"))
 	assert.Equal(t, 57, n)
 	assert.False(t, done)
 
 	// Test: Valid 2 headers with existing headers
-	headers = map[string]string{"host": "localhost:42069"}
+	headers = NewHeaders()
+	headers.Add("Host", "localhost:42069")
 	data = []byte("User-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
-	assert.Equal(t, "curl/7.81.0", headers["user-agent"])
+	assert.Equal(t, "localhost:42069", headerValue(headers, "host"))
+	assert.Equal(t, "curl/7.81.0", headerValue(headers, "user-agent"))
 	assert.Equal(t, 25, n)
 	assert.False(t, done)
 
@@ -45,7 +46,7 @@ func TestHeadersParse(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Empty(t, headers)
+	assert.Equal(t, 0, headers.Len())
 	assert.Equal(t, 2, n)
 	assert.True(t, done)
 
@@ -82,12 +83,166 @@ func TestHeadersParse(t *testing.T) {
 	assert.False(t, done)
 
 	// Test: Valid multiple values
-	headers = map[string]string{"set-person": "test1"}
+	headers = NewHeaders()
+	headers.Add("set-person", "test1")
 	data = []byte("Set-PERSON: new-person\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "test1, new-person", headers["set-person"])
+	assert.Equal(t, "test1, new-person", headerValue(headers, "set-person"))
 	assert.Equal(t, 24, n)
 	assert.False(t, done)
+
+	// Test: Missing colon
+	headers = NewHeaders()
+	data = []byte("Host localhost\r\n\r\n")
+	n, done, err = headers.Parse(data)
+	require.ErrorIs(t, err, ErrMalformedFieldLine)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+
+	// Test: Tab before colon
+	headers = NewHeaders()
+	data = []byte("Host\t: localhost\r\n\r\n")
+	_, _, err = headers.Parse(data)
+	require.ErrorIs(t, err, ErrInvalidHeaderName)
+
+	// Test: Obsolete line folding
+	headers = NewHeaders()
+	headers.Add("Host", "localhost")
+	data = []byte(" Transfer-Encoding: chunked\r\n\r\n")
+	_, _, err = headers.Parse(data)
+	require.ErrorIs(t, err, ErrMalformedFieldLine)
+	assert.Equal(t, 1, headers.Len())
+
+	// Test: Invalid header name error carries its status code
+	headers = NewHeaders()
+	data = []byte("Ho st: localhost\r\n\r\n")
+	_, _, err = headers.Parse(data)
+	require.ErrorIs(t, err, ErrInvalidHeaderName)
+	var headersErr *Error
+	require.ErrorAs(t, err, &headersErr)
+	assert.Equal(t, 400, headersErr.StatusCode)
+}
+
+func TestIsToken(t *testing.T) {
+	assert.True(t, IsToken("session_id"))
+	assert.True(t, IsToken("!#$%&'*+-.^_`|~"))
+	assert.False(t, IsToken(""))
+	assert.False(t, IsToken("a b"))
+	assert.False(t, IsToken("a=b"))
+	assert.False(t, IsToken("é"))
+}
+
+func headerValue(h *Headers, key string) string {
+	v, _ := h.Get(key)
+	return v
+}
+
+func TestHeadersMultiValue(t *testing.T) {
+	// Test: Repeated fields keep their order and casing
+	headers := NewHeaders()
+	data := []byte("Set-Cookie: a=1\r\nWWW-Authenticate: Basic realm=\"x\"\r\nset-cookie: b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT\r\n\r\n")
+	total := 0
+	for {
+		n, done, err := headers.Parse(data[total:])
+		require.NoError(t, err)
+		total += n
+		if done {
+			break
+		}
+	}
+	assert.Equal(t, 3, headers.Len())
+	assert.Equal(t, []string{"a=1", "b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT"}, headers.Values("SET-COOKIE"))
+	var names []string
+	for name := range headers.All() {
+		names = append(names, name)
+	}
+	assert.Equal(t, []string{"Set-Cookie", "WWW-Authenticate", "set-cookie"}, names)
+
+	// Test: Add appends, Get combines
+	headers = NewHeaders()
+	require.NoError(t, headers.Add("Accept", "text/html"))
+	require.NoError(t, headers.Add("Vary", "Accept"))
+	require.NoError(t, headers.Add("accept", "application/json"))
+	v, ok := headers.Get("Accept")
+	assert.True(t, ok)
+	assert.Equal(t, "text/html, application/json", v)
+	_, ok = headers.Get("Missing")
+	assert.False(t, ok)
+	assert.Nil(t, headers.Values("Missing"))
+
+	// Test: Set replaces every value in place of the first
+	require.NoError(t, headers.Set("ACCEPT", "*/*"))
+	assert.Equal(t, []string{"*/*"}, headers.Values("accept"))
+	var fields []Field
+	for name, value := range headers.All() {
+		fields = append(fields, Field{Name: name, Value: value})
+	}
+	assert.Equal(t, []Field{{"ACCEPT", "*/*"}, {"Vary", "Accept"}}, fields)
+
+	// Test: Set on a new key appends
+	require.NoError(t, headers.Set("Content-Type", "text/plain"))
+	assert.Equal(t, 3, headers.Len())
+
+	// Test: Del removes every value
+	require.NoError(t, headers.Add("vary", "Accept-Encoding"))
+	headers.Del("VARY")
+	assert.Nil(t, headers.Values("Vary"))
+	assert.Equal(t, 2, headers.Len())
+
+	// Test: HasToken looks through every field line
+	headers = NewHeaders()
+	headers.Add("Connection", "keep-alive")
+	headers.Add("Connection", "Upgrade, Close")
+	assert.True(t, headers.HasToken("connection", "close"))
+	assert.False(t, headers.HasToken("connection", "te"))
+}
+
+func TestCanonicalName(t *testing.T) {
+	// Test: Canonical casing
+	assert.Equal(t, "Content-Type", CanonicalName("content-type"))
+	assert.Equal(t, "Content-Length", CanonicalName("CONTENT-LENGTH"))
+	assert.Equal(t, "X-Request-Id", CanonicalName("x-REQUEST-id"))
+	assert.Equal(t, "Etag", CanonicalName("ETag"))
+	assert.Equal(t, "A--B", CanonicalName("a--b"))
+	assert.Equal(t, "", CanonicalName(""))
+}
+
+func TestHeaderValueValidation(t *testing.T) {
+	// Test: Bare CR in value
+	headers := NewHeaders()
+	_, _, err := headers.Parse([]byte("X-Foo: a\rb\r\n\r\n"))
+	require.ErrorIs(t, err, ErrInvalidHeaderValue)
+
+	// Test: Bare LF in value
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("X-Foo: a\nInjected: 1\r\n\r\n"))
+	require.ErrorIs(t, err, ErrInvalidHeaderValue)
+
+	// Test: NUL in value
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("X-Foo: a\x00\r\n\r\n"))
+	require.ErrorIs(t, err, ErrInvalidHeaderValue)
+
+	// Test: Tab inside value and obs-text are allowed
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("X-Foo:\ta\tb\xe9 \r\n\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "a\tb\xe9", headerValue(headers, "x-foo"))
+
+	// Test: Non-ASCII name
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("Hé: x\r\n\r\n"))
+	require.ErrorIs(t, err, ErrInvalidHeaderName)
+
+	// Test: Set and Add refuse CRLF injection
+	headers = NewHeaders()
+	require.NoError(t, headers.Set("Location", "/ok"))
+	require.ErrorIs(t, headers.Set("Location", "/x\r\nSet-Cookie: evil=1"), ErrInvalidHeaderValue)
+	require.ErrorIs(t, headers.Add("X-Echo", "a\nb"), ErrInvalidHeaderValue)
+	require.ErrorIs(t, headers.Add("X Echo", "a"), ErrInvalidHeaderName)
+	require.ErrorIs(t, headers.Add("", "a"), ErrInvalidHeaderName)
+	assert.Equal(t, 1, headers.Len())
+	assert.Equal(t, "/ok", headerValue(headers, "Location"))
 }
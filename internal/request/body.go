@@ -0,0 +1,415 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/iferdel-vault/tcptohttp/internal/headers"
+)
+
+// maxChunkSizeDigits and maxContentLengthDigits keep lengths from
+// overflowing an int.
+const (
+	maxChunkSizeDigits     = 15
+	maxContentLengthDigits = 18
+)
+
+// body reads a request body from the connection on demand, removing the
+// Content-Length or chunked framing as it goes.
+type body struct {
+	req    *Request
+	rr     *Reader
+	err    error
+	closed bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, errors.New("read on closed body")
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.req.continueFunc != nil && b.req.state != requestStateDone && len(p) > 0 {
+		fn := b.req.continueFunc
+		b.req.continueFunc = nil
+		if b.req.ExpectsContinue() {
+			err := fn()
+			if err != nil {
+				b.err = err
+				return 0, err
+			}
+		}
+	}
+	n := 0
+	for n < len(p) {
+		if b.req.state == requestStateDone {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, io.EOF
+		}
+
+		if b.rr.readToIndex == 0 && b.req.readsBodyData() {
+			// nothing buffered: read the body straight into p
+			m, err := b.readDirect(p[n:])
+			n += m
+			if err != nil {
+				b.err = err
+				return n, err
+			}
+			if m > 0 {
+				return n, nil
+			}
+			continue
+		}
+
+		consumed, written, err := b.req.parseBody(b.rr.buf[:b.rr.readToIndex], p[n:])
+		if err != nil {
+			b.err = err
+			return n, err
+		}
+		b.rr.discard(consumed)
+		n += written
+		if consumed > 0 {
+			continue
+		}
+		if n > 0 {
+			return n, nil
+		}
+		err = b.rr.fill()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = fmt.Errorf("%w: body ended in state: %d, read %d bytes: %w", ErrIncompleteRequest, b.req.state, b.req.bodyLengthRead, io.ErrUnexpectedEOF)
+			}
+			b.err = err
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (b *body) Close() error {
+	b.closed = true
+	return nil
+}
+
+// UnreadBodyLength reports how much of the body is left to read: 0 once it
+// is complete, or -1 if that is not known because the body is chunked.
+func (r *Request) UnreadBodyLength() int {
+	switch r.state {
+	case requestStateDone:
+		return 0
+	case requestStateParsingBody:
+		return r.contentLength - r.bodyLengthRead
+	}
+	return -1
+}
+
+// DiscardBody reads and drops what is left of the body, up to n bytes, even
+// if BodyReader was closed. It reports whether the body is complete, so
+// that the next request on the connection can be read.
+func (r *Request) DiscardBody(n int64) bool {
+	b, ok := r.BodyReader.(*body)
+	if !ok || r.state == requestStateDone {
+		return r.state == requestStateDone
+	}
+	closed := b.closed
+	b.closed = false
+	_, err := io.CopyN(io.Discard, b, n+1)
+	b.closed = closed
+	return errors.Is(err, io.EOF) && r.state == requestStateDone
+}
+
+// readDirect reads body data from the connection into p without going
+// through the buffer.
+func (b *body) readDirect(p []byte) (int, error) {
+	remaining := b.req.contentLength - b.req.bodyLengthRead
+	if b.req.state == requestStateParsingChunkData {
+		remaining = b.req.chunkRemaining
+	}
+	n, err := b.rr.reader.Read(p[:min(len(p), remaining)])
+	if n > 0 {
+		b.req.consumeBodyData(n)
+	}
+	if errors.Is(err, io.EOF) {
+		if n > 0 {
+			b.rr.err = err
+			return n, nil
+		}
+		return 0, fmt.Errorf("%w: body ended in state: %d, read %d bytes: %w", ErrIncompleteRequest, b.req.state, b.req.bodyLengthRead, io.ErrUnexpectedEOF)
+	}
+	return n, err
+}
+
+// startBody picks the body framing once the header section is complete,
+// following RFC 9112 §6.3. Anything that could let an intermediary and this
+// server disagree on where the body ends is rejected.
+func (r *Request) startBody() error {
+	te, hasTE := r.Headers.Get("Transfer-Encoding")
+	clStr, hasCL := r.Headers.Get("Content-Length")
+
+	if hasTE {
+		if hasCL {
+			return fmt.Errorf("%w: both Transfer-Encoding and Content-Length are present", ErrInvalidFraming)
+		}
+		if r.RequestLine.HttpVersion == "1.0" {
+			return fmt.Errorf("%w: Transfer-Encoding in an HTTP/1.0 request", ErrInvalidFraming)
+		}
+		err := checkTransferCodings(te)
+		if err != nil {
+			return err
+		}
+		r.state = requestStateParsingChunkSize
+		return nil
+	}
+
+	if !hasCL {
+		// assume that if no content-length header is present, there is no body
+		r.state = requestStateDone
+		return nil
+	}
+	cl, err := parseContentLength(clStr)
+	if err != nil {
+		return err
+	}
+	err = r.checkBodyLength(cl)
+	if err != nil {
+		return err
+	}
+	r.contentLength = cl
+	if cl == 0 {
+		r.state = requestStateDone
+		return nil
+	}
+	r.state = requestStateParsingBody
+	return nil
+}
+
+// checkTransferCodings accepts only "chunked", which must be applied exactly
+// once and last. Other codings cannot be decoded here.
+func checkTransferCodings(te string) error {
+	var codings []string
+	for _, coding := range strings.Split(te, ",") {
+		coding = strings.Trim(coding, " \t")
+		if coding != "" {
+			codings = append(codings, coding)
+		}
+	}
+	if len(codings) == 0 {
+		return fmt.Errorf("%w: empty Transfer-Encoding", ErrInvalidFraming)
+	}
+	for _, coding := range codings {
+		if !strings.EqualFold(coding, "chunked") {
+			return fmt.Errorf("%w: %q", ErrUnsupportedTransferCoding, coding)
+		}
+	}
+	if len(codings) > 1 {
+		return fmt.Errorf("%w: chunked applied more than once: %s", ErrInvalidFraming, te)
+	}
+	return nil
+}
+
+// parseContentLength parses 1*DIGIT, where a list of identical values from
+// repeated fields counts as one.
+func parseContentLength(value string) (int, error) {
+	cl := -1
+	for _, v := range strings.Split(value, ",") {
+		v = strings.Trim(v, " \t")
+		if v == "" || len(v) > maxContentLengthDigits {
+			return 0, fmt.Errorf("%w: %q", ErrMalformedContentLength, value)
+		}
+		for i := 0; i < len(v); i++ {
+			if v[i] < '0' || v[i] > '9' {
+				return 0, fmt.Errorf("%w: %q", ErrMalformedContentLength, value)
+			}
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", ErrMalformedContentLength, err)
+		}
+		if cl != -1 && n != cl {
+			return 0, fmt.Errorf("%w: conflicting values: %q", ErrMalformedContentLength, value)
+		}
+		cl = n
+	}
+	return cl, nil
+}
+
+func (r *Request) readsBodyData() bool {
+	return r.state == requestStateParsingBody || r.state == requestStateParsingChunkData
+}
+
+func (r *Request) consumeBodyData(n int) {
+	r.bodyLengthRead += n
+	switch r.state {
+	case requestStateParsingBody:
+		if r.bodyLengthRead == r.contentLength {
+			r.state = requestStateDone
+		}
+	case requestStateParsingChunkData:
+		r.chunkRemaining -= n
+		if r.chunkRemaining == 0 {
+			r.state = requestStateParsingChunkDataEnd
+		}
+	}
+}
+
+// parseBody consumes body framing from data and copies body bytes into p.
+// It returns the number of bytes consumed from data and written to p.
+func (r *Request) parseBody(data, p []byte) (int, int, error) {
+	switch r.state {
+	case requestStateParsingBody:
+		n := copy(p, data[:min(len(data), r.contentLength-r.bodyLengthRead)])
+		r.consumeBodyData(n)
+		return n, n, nil
+	case requestStateParsingChunkSize:
+		size, n, err := parseChunkSize(data)
+		if err != nil {
+			return 0, 0, err
+		}
+		if n == 0 {
+			if len(data) > maxChunkLineBytes {
+				return 0, 0, fmt.Errorf("%w: chunk-size line longer than %d bytes", ErrMalformedChunk, maxChunkLineBytes)
+			}
+			return 0, 0, nil
+		}
+		err = r.checkBodyLength(r.bodyLengthRead + size)
+		if err != nil {
+			return 0, 0, err
+		}
+		if size == 0 {
+			r.state = requestStateParsingTrailers
+			return n, 0, nil
+		}
+		r.chunkRemaining = size
+		r.state = requestStateParsingChunkData
+		return n, 0, nil
+	case requestStateParsingChunkData:
+		n := copy(p, data[:min(len(data), r.chunkRemaining)])
+		r.consumeBodyData(n)
+		return n, n, nil
+	case requestStateParsingChunkDataEnd:
+		if len(data) < len(crlf) {
+			return 0, 0, nil
+		}
+		if !bytes.HasPrefix(data, []byte(crlf)) {
+			return 0, 0, fmt.Errorf("%w: chunk data is not terminated by CRLF", ErrMalformedChunk)
+		}
+		r.state = requestStateParsingChunkSize
+		return len(crlf), 0, nil
+	case requestStateParsingTrailers:
+		n, done, err := r.parseField(r.Trailers, data)
+		if err != nil {
+			return 0, 0, err
+		}
+		if done {
+			r.state = requestStateDone
+		}
+		return n, 0, nil
+	default:
+		return 0, 0, fmt.Errorf("error: trying to read body in state: %d", r.state)
+	}
+}
+
+// parseChunkSize parses a chunk-size line. Chunk extensions are checked
+// but otherwise ignored:
+//
+//	chunk-size [ chunk-ext ] CRLF
+func parseChunkSize(data []byte) (int, int, error) {
+	idx := bytes.Index(data, []byte(crlf))
+	if idx == -1 {
+		return 0, 0, nil
+	}
+	if idx > maxChunkLineBytes {
+		return 0, 0, fmt.Errorf("%w: chunk-size line longer than %d bytes", ErrMalformedChunk, maxChunkLineBytes)
+	}
+	line := string(data[:idx])
+	sizeStr, ext := line, ""
+	if i := strings.IndexAny(line, " \t;"); i >= 0 {
+		sizeStr, ext = line[:i], line[i:]
+	}
+	if sizeStr == "" || len(sizeStr) > maxChunkSizeDigits {
+		return 0, 0, fmt.Errorf("%w: malformed chunk size: %q", ErrMalformedChunk, line)
+	}
+	size, err := strconv.ParseUint(sizeStr, 16, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: malformed chunk size: %q", ErrMalformedChunk, line)
+	}
+	if !validChunkExt(ext) {
+		// a lenient parser elsewhere could end the line at a bare LF
+		return 0, 0, fmt.Errorf("%w: malformed chunk extension: %q", ErrMalformedChunk, line)
+	}
+	return int(size), idx + len(crlf), nil
+}
+
+// validChunkExt checks chunk extensions against RFC 9112 §7.1.1:
+//
+//	chunk-ext = *( BWS ";" BWS chunk-ext-name [ BWS "=" BWS chunk-ext-val ] )
+//
+// where the name is a token and the value a token or a quoted-string.
+func validChunkExt(ext string) bool {
+	for {
+		ext = strings.TrimLeft(ext, " \t")
+		if ext == "" {
+			return true
+		}
+		if ext[0] != ';' {
+			return false
+		}
+		ext = strings.TrimLeft(ext[1:], " \t")
+		end := tokenEnd(ext, " \t=;")
+		if !headers.IsToken(ext[:end]) {
+			return false
+		}
+		ext = strings.TrimLeft(ext[end:], " \t")
+		if ext == "" || ext[0] != '=' {
+			continue
+		}
+		ext = strings.TrimLeft(ext[1:], " \t")
+		if ext != "" && ext[0] == '"' {
+			n := quotedStringLen(ext)
+			if n == 0 {
+				return false
+			}
+			ext = ext[n:]
+			continue
+		}
+		end = tokenEnd(ext, " \t;")
+		if !headers.IsToken(ext[:end]) {
+			return false
+		}
+		ext = ext[end:]
+	}
+}
+
+// tokenEnd returns the index of the first byte of s in delims, or len(s).
+func tokenEnd(s, delims string) int {
+	if i := strings.IndexAny(s, delims); i >= 0 {
+		return i
+	}
+	return len(s)
+}
+
+// quotedStringLen returns the length of the quoted-string at the start of
+// s, or 0 if there is none. Control characters other than HTAB are not
+// allowed, escaped or not.
+func quotedStringLen(s string) int {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			i++
+			c = s[i]
+		} else if c == '"' {
+			return i + 1
+		}
+		if (c < 0x20 && c != '\t') || c == 0x7f {
+			return 0
+		}
+	}
+	return 0
+}
@@ -0,0 +1,61 @@
+package request
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/iferdel-vault/tcptohttp/internal/headers"
+)
+
+var ErrNoCookie = errors.New("named cookie not present")
+
+// Cookie is a name/value pair sent in the Cookie header.
+type Cookie struct {
+	Name  string
+	Value string
+}
+
+// Cookies parses the Cookie header as described in RFC 6265 §5.4. Pairs
+// with an invalid name are skipped; a quoted value is unquoted.
+func (r *Request) Cookies() []*Cookie {
+	var cookies []*Cookie
+	for _, line := range r.Headers.Values("Cookie") {
+		for _, pair := range strings.Split(line, ";") {
+			pair = strings.Trim(pair, " \t")
+			name, value, ok := strings.Cut(pair, "=")
+			if !ok || !headers.IsToken(name) {
+				continue
+			}
+			if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+				value = value[1 : len(value)-1]
+			}
+			if !validCookieValue(value) {
+				continue
+			}
+			cookies = append(cookies, &Cookie{Name: name, Value: value})
+		}
+	}
+	return cookies
+}
+
+// Cookie returns the first cookie with the given name.
+func (r *Request) Cookie(name string) (*Cookie, error) {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return nil, ErrNoCookie
+}
+
+// validCookieValue accepts cookie-octets, plus the spaces and commas that
+// some servers put in values anyway.
+func validCookieValue(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= 0x7f || c == '"' || c == ';' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+package request
+
+// Error is a request parse failure. StatusCode is the response status the
+// failure maps to. Failures are reported wrapped around one of the Err
+// values below, so they can be told apart with errors.Is and their status
+// read with errors.As.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	ErrMalformedRequestLine      = &Error{StatusCode: 400, Message: "malformed request-line"}
+	ErrInvalidMethod             = &Error{StatusCode: 400, Message: "invalid method"}
+	ErrInvalidTarget             = &Error{StatusCode: 400, Message: "invalid request-target"}
+	ErrUnsupportedVersion        = &Error{StatusCode: 505, Message: "unsupported HTTP-version"}
+	ErrIncompleteRequest         = &Error{StatusCode: 400, Message: "incomplete request"}
+	ErrMalformedContentLength    = &Error{StatusCode: 400, Message: "malformed Content-Length"}
+	ErrInvalidFraming            = &Error{StatusCode: 400, Message: "invalid message framing"}
+	ErrMalformedChunk            = &Error{StatusCode: 400, Message: "malformed chunked body"}
+	ErrUnsupportedTransferCoding = &Error{StatusCode: 501, Message: "unsupported transfer-coding"}
+	ErrRequestLineTooLong        = &Error{StatusCode: 414, Message: "request-line too long"}
+	ErrHeadersTooLarge           = &Error{StatusCode: 431, Message: "request header fields too large"}
+	ErrBodyTooLarge              = &Error{StatusCode: 413, Message: "request body too large"}
+	ErrMalformedForm             = &Error{StatusCode: 400, Message: "malformed form body"}
+	ErrUnsupportedMediaType      = &Error{StatusCode: 415, Message: "unsupported media type"}
+)
@@ -0,0 +1,149 @@
+package request
+
+import (
+	"fmt"
+	"io"
+	"mime"
+)
+
+// maxFormBytes bounds an application/x-www-form-urlencoded body, which is
+// held in memory whole.
+const maxFormBytes = 10 << 20
+
+// defaultMaxMemory is how much of a multipart form FormValue and FormFile
+// keep in memory before file parts spill to disk.
+const defaultMaxMemory = 32 << 20
+
+// ParseForm fills Form with the query values and, for POST, PUT and PATCH
+// requests with an application/x-www-form-urlencoded body, the body values,
+// which also go to PostForm. Body values come first in Form.
+func (r *Request) ParseForm() error {
+	if r.PostForm == nil {
+		r.PostForm = Values{}
+		if r.hasFormBody() && r.mediaType() == "application/x-www-form-urlencoded" {
+			values, err := r.readURLEncodedForm()
+			if err != nil {
+				return err
+			}
+			r.PostForm = values
+		}
+	}
+	if r.Form == nil {
+		r.Form = Values{}
+		for k, vs := range r.PostForm {
+			r.Form[k] = append(r.Form[k], vs...)
+		}
+		for k, vs := range r.RequestLine.Target.Query {
+			r.Form[k] = append(r.Form[k], vs...)
+		}
+	}
+	return nil
+}
+
+// ParseMultipartForm parses a multipart/form-data body into MultipartForm.
+// Up to maxMemory bytes of file parts are kept in memory, the rest are
+// written to temporary files that MultipartForm.RemoveAll deletes. Field
+// values are also added to Form and PostForm.
+func (r *Request) ParseMultipartForm(maxMemory int64) error {
+	if r.MultipartForm != nil {
+		return nil
+	}
+	err := r.ParseForm()
+	if err != nil {
+		return err
+	}
+	if r.mediaType() != "multipart/form-data" {
+		return fmt.Errorf("%w: not multipart/form-data", ErrUnsupportedMediaType)
+	}
+	_, params, _ := mime.ParseMediaType(r.contentType())
+	boundary := params["boundary"]
+	if boundary == "" {
+		return fmt.Errorf("%w: missing multipart boundary", ErrMalformedForm)
+	}
+
+	mr := newMultipartReader(r.BodyReader, boundary, r.limits)
+	form, err := mr.readForm(maxMemory)
+	if err != nil {
+		return err
+	}
+	r.MultipartForm = form
+	for k, vs := range form.Value {
+		r.Form[k] = append(r.Form[k], vs...)
+		r.PostForm[k] = append(r.PostForm[k], vs...)
+	}
+	return nil
+}
+
+// FormValue returns the first value for key from the query or the body,
+// parsing the form first if needed. Parse errors are ignored.
+func (r *Request) FormValue(key string) string {
+	if r.Form == nil || (r.MultipartForm == nil && r.mediaType() == "multipart/form-data") {
+		r.ParseMultipartForm(defaultMaxMemory)
+	}
+	return r.Form.Get(key)
+}
+
+// PostFormValue is like FormValue but ignores the query.
+func (r *Request) PostFormValue(key string) string {
+	if r.PostForm == nil || (r.MultipartForm == nil && r.mediaType() == "multipart/form-data") {
+		r.ParseMultipartForm(defaultMaxMemory)
+	}
+	return r.PostForm.Get(key)
+}
+
+// FormFile returns the first file part for key, parsing the multipart form
+// first if needed.
+func (r *Request) FormFile(key string) (File, *FileHeader, error) {
+	if r.MultipartForm == nil {
+		err := r.ParseMultipartForm(defaultMaxMemory)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	fhs := r.MultipartForm.File[key]
+	if len(fhs) == 0 {
+		return nil, nil, fmt.Errorf("no file part named %q", key)
+	}
+	f, err := fhs[0].Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, fhs[0], nil
+}
+
+func (r *Request) hasFormBody() bool {
+	switch r.RequestLine.Method {
+	case "POST", "PUT", "PATCH":
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *Request) contentType() string {
+	ct, _ := r.Headers.Get("Content-Type")
+	return ct
+}
+
+func (r *Request) mediaType() string {
+	mediaType, _, err := mime.ParseMediaType(r.contentType())
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+func (r *Request) readURLEncodedForm() (Values, error) {
+	b, err := io.ReadAll(io.LimitReader(r.BodyReader, maxFormBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxFormBytes {
+		return nil, fmt.Errorf("%w: form body over %d bytes", ErrBodyTooLarge, maxFormBytes)
+	}
+	values, err := parseQuery(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedForm, err)
+	}
+	return values, nil
+}
@@ -0,0 +1,61 @@
+package request
+
+import "fmt"
+
+// Limits bounds how much of a request is read before it is rejected. A zero
+// field means no limit.
+type Limits struct {
+	MaxRequestLineBytes int
+	// MaxHeaderBytes and MaxHeaderCount cover the header section and the
+	// trailer section of a chunked body together.
+	MaxHeaderBytes int
+	MaxHeaderCount int
+	MaxBodyBytes   int
+	// MaxFormParts and MaxFormPartBytes bound a multipart/form-data body.
+	MaxFormParts     int
+	MaxFormPartBytes int
+}
+
+// DefaultLimits leaves the body unbounded since it is streamed rather than
+// held in memory.
+var DefaultLimits = Limits{
+	MaxRequestLineBytes: 8 << 10,
+	MaxHeaderBytes:      64 << 10,
+	MaxHeaderCount:      100,
+	MaxFormParts:        1000,
+}
+
+// maxChunkLineBytes bounds a chunk-size line including its extensions.
+const maxChunkLineBytes = 4 << 10
+
+func exceeds(n, limit int) bool {
+	return limit > 0 && n > limit
+}
+
+// checkRequestLine is called with the unparsed bytes while the request-line
+// is incomplete, so it fails before the buffer grows past the limit.
+func (r *Request) checkRequestLine(pending int) error {
+	if exceeds(pending, r.limits.MaxRequestLineBytes+len(crlf)) {
+		return fmt.Errorf("%w: more than %d bytes", ErrRequestLineTooLong, r.limits.MaxRequestLineBytes)
+	}
+	return nil
+}
+
+// checkFields accounts for parsed field lines in the header or trailer
+// section, plus any pending bytes of an incomplete line.
+func (r *Request) checkFields(pending int) error {
+	if exceeds(r.fieldBytes+pending, r.limits.MaxHeaderBytes) {
+		return fmt.Errorf("%w: more than %d bytes", ErrHeadersTooLarge, r.limits.MaxHeaderBytes)
+	}
+	if exceeds(r.fieldCount, r.limits.MaxHeaderCount) {
+		return fmt.Errorf("%w: more than %d fields", ErrHeadersTooLarge, r.limits.MaxHeaderCount)
+	}
+	return nil
+}
+
+func (r *Request) checkBodyLength(length int) error {
+	if exceeds(length, r.limits.MaxBodyBytes) {
+		return fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, r.limits.MaxBodyBytes)
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+package request
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+
+	"github.com/iferdel-vault/tcptohttp/internal/headers"
+)
+
+// maxPartHeaderBytes bounds the header section of a single part.
+const maxPartHeaderBytes = 16 << 10
+
+// MultipartForm is a parsed multipart/form-data body.
+type MultipartForm struct {
+	Value Values
+	File  map[string][]*FileHeader
+}
+
+// RemoveAll deletes the temporary files of file parts that did not fit in
+// memory.
+func (f *MultipartForm) RemoveAll() error {
+	var errs []error
+	for _, fhs := range f.File {
+		for _, fh := range fhs {
+			if fh.tmpfile == "" {
+				continue
+			}
+			err := os.Remove(fh.tmpfile)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FileHeader describes a file part. Its content is either in memory or in
+// a temporary file.
+type FileHeader struct {
+	Filename string
+	Header   *headers.Headers
+	Size     int64
+	content  []byte
+	tmpfile  string
+}
+
+// File is the content of a file part.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+// Open opens the content of the file part.
+func (fh *FileHeader) Open() (File, error) {
+	if fh.tmpfile != "" {
+		return os.Open(fh.tmpfile)
+	}
+	return memoryFile{io.NewSectionReader(bytes.NewReader(fh.content), 0, fh.Size)}, nil
+}
+
+type memoryFile struct {
+	*io.SectionReader
+}
+
+func (memoryFile) Close() error {
+	return nil
+}
+
+// multipartReader splits a multipart body into parts as described in
+// RFC 2046 §5.1.1.
+type multipartReader struct {
+	br              *bufio.Reader
+	dashBoundary    []byte // "--" boundary
+	nlDashBoundary  []byte // CRLF "--" boundary
+	limits          Limits
+	current         *part
+	partsRead       int
+	started, closed bool
+}
+
+func newMultipartReader(r io.Reader, boundary string, limits Limits) *multipartReader {
+	return &multipartReader{
+		br:             bufio.NewReaderSize(r, 4096+len(boundary)),
+		dashBoundary:   []byte("--" + boundary),
+		nlDashBoundary: []byte("\r\n--" + boundary),
+		limits:         limits,
+	}
+}
+
+// readForm reads every part, keeping fields and up to maxMemory bytes of
+// files in memory.
+func (mr *multipartReader) readForm(maxMemory int64) (_ *MultipartForm, err error) {
+	form := &MultipartForm{Value: Values{}, File: map[string][]*FileHeader{}}
+	defer func() {
+		if err != nil {
+			form.RemoveAll()
+		}
+	}()
+
+	for {
+		p, err := mr.nextPart()
+		if errors.Is(err, io.EOF) {
+			return form, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name, filename := p.formName()
+		if name == "" {
+			continue
+		}
+
+		var b bytes.Buffer
+		n, err := io.CopyN(&b, p, maxMemory+1)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		if filename == "" {
+			maxMemory -= n
+			if maxMemory < 0 {
+				return nil, fmt.Errorf("%w: form fields over the memory limit", ErrBodyTooLarge)
+			}
+			form.Value[name] = append(form.Value[name], b.String())
+			continue
+		}
+
+		fh := &FileHeader{Filename: filename, Header: p.header}
+		if n <= maxMemory {
+			maxMemory -= n
+			fh.content = b.Bytes()
+			fh.Size = n
+		} else {
+			// too big for memory, move it to disk
+			f, err := os.CreateTemp("", "multipart-")
+			if err != nil {
+				return nil, err
+			}
+			fh.tmpfile = f.Name()
+			form.File[name] = append(form.File[name], fh)
+			fh.Size, err = io.Copy(f, io.MultiReader(&b, p))
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		form.File[name] = append(form.File[name], fh)
+	}
+}
+
+// nextPart skips the rest of the current part and parses the header section
+// of the next one. It returns io.EOF after the close-delimiter.
+func (mr *multipartReader) nextPart() (*part, error) {
+	if mr.current != nil {
+		_, err := io.Copy(io.Discard, mr.current)
+		if err != nil {
+			return nil, err
+		}
+		mr.current = nil
+	}
+	if !mr.started {
+		err := mr.skipPreamble()
+		if err != nil {
+			return nil, err
+		}
+		mr.started = true
+	}
+	if mr.closed {
+		return nil, io.EOF
+	}
+
+	mr.partsRead++
+	if exceeds(mr.partsRead, mr.limits.MaxFormParts) {
+		return nil, fmt.Errorf("%w: more than %d parts", ErrBodyTooLarge, mr.limits.MaxFormParts)
+	}
+	p := &part{mr: mr, header: headers.NewHeaders()}
+	headerBytes := 0
+	for {
+		line, err := mr.br.ReadSlice('\n')
+		if err != nil {
+			return nil, mr.malformed(err)
+		}
+		headerBytes += len(line)
+		if headerBytes > maxPartHeaderBytes {
+			return nil, fmt.Errorf("%w: part header section over %d bytes", ErrMalformedForm, maxPartHeaderBytes)
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			// a whitespace-preceded line is never a field line of its own
+			return nil, fmt.Errorf("%w: %w: leading whitespace", ErrMalformedForm, headers.ErrMalformedFieldLine)
+		}
+		n, done, err := p.header.Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMalformedForm, err)
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("%w: part header line not ended by CRLF", ErrMalformedForm)
+		}
+		if done {
+			break
+		}
+	}
+	mr.current = p
+	return p, nil
+}
+
+// skipPreamble discards everything up to the first delimiter line.
+func (mr *multipartReader) skipPreamble() error {
+	for {
+		line, err := mr.br.ReadSlice('\n')
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+			return mr.malformed(err)
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		line = bytes.TrimRight(line, " \t\r\n")
+		if bytes.Equal(line, mr.dashBoundary) {
+			return nil
+		}
+		if bytes.HasPrefix(line, mr.dashBoundary) && bytes.Equal(line[len(mr.dashBoundary):], []byte("--")) {
+			mr.closed = true
+			return nil
+		}
+	}
+}
+
+// endDelimiter reads what follows a delimiter: "--" for the close-delimiter
+// or CRLF before the next part, either after optional transport padding.
+func (mr *multipartReader) endDelimiter() error {
+	line, err := mr.br.ReadSlice('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && bytes.HasPrefix(line, []byte("--"))) {
+		return mr.malformed(err)
+	}
+	if bytes.HasPrefix(line, []byte("--")) {
+		mr.closed = true
+		return nil
+	}
+	if string(bytes.TrimLeft(line, " \t")) != crlf {
+		return fmt.Errorf("%w: unexpected data after boundary: %q", ErrMalformedForm, line)
+	}
+	return nil
+}
+
+// findDelimiter returns the index of the first delimiter in buf. A CRLF
+// "--" boundary only counts when followed by "--" or by optional whitespace
+// and CRLF. decided is false when buf ends before that can be told.
+func (mr *multipartReader) findDelimiter(buf []byte, atEOF bool) (int, bool) {
+	offset := 0
+	for {
+		idx := bytes.Index(buf[offset:], mr.nlDashBoundary)
+		if idx == -1 {
+			return -1, true
+		}
+		idx += offset
+		rest := buf[idx+len(mr.nlDashBoundary):]
+		if bytes.HasPrefix(rest, []byte("--")) {
+			return idx, true
+		}
+		rest = bytes.TrimLeft(rest, " \t")
+		if bytes.HasPrefix(rest, []byte(crlf)) {
+			return idx, true
+		}
+		if !atEOF && (len(rest) == 0 || string(rest) == "\r" || string(rest) == "-") {
+			return idx, false
+		}
+		offset = idx + 1
+	}
+}
+
+func (mr *multipartReader) malformed(err error) error {
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: body ended before the close-delimiter", ErrMalformedForm)
+	}
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return fmt.Errorf("%w: line too long", ErrMalformedForm)
+	}
+	return err
+}
+
+// part reads one part's content up to the next delimiter.
+type part struct {
+	mr     *multipartReader
+	header *headers.Headers
+	size   int
+	eof    bool
+}
+
+func (p *part) Read(d []byte) (int, error) {
+	if p.eof {
+		return 0, io.EOF
+	}
+	br := p.mr.br
+	buf, peekErr := br.Peek(br.Size())
+	if peekErr != nil && !errors.Is(peekErr, bufio.ErrBufferFull) && !errors.Is(peekErr, io.EOF) {
+		return 0, peekErr
+	}
+	idx, decided := p.mr.findDelimiter(buf, peekErr != nil && errors.Is(peekErr, io.EOF))
+	if idx >= 0 {
+		n := copy(d, buf[:idx])
+		br.Discard(n)
+		err := p.count(n)
+		if err != nil || n < idx {
+			return n, err
+		}
+		if !decided {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, fmt.Errorf("%w: transport padding too long", ErrMalformedForm)
+		}
+		br.Discard(len(p.mr.nlDashBoundary))
+		p.eof = true
+		err = p.mr.endDelimiter()
+		if err != nil {
+			return n, err
+		}
+		return n, io.EOF
+	}
+	if peekErr != nil && errors.Is(peekErr, io.EOF) {
+		return 0, p.mr.malformed(peekErr)
+	}
+	// the tail of buf could be the start of a delimiter
+	safe := len(buf) - len(p.mr.nlDashBoundary) + 1
+	n := copy(d, buf[:safe])
+	br.Discard(n)
+	return n, p.count(n)
+}
+
+func (p *part) count(n int) error {
+	p.size += n
+	if exceeds(p.size, p.mr.limits.MaxFormPartBytes) {
+		return fmt.Errorf("%w: part over %d bytes", ErrBodyTooLarge, p.mr.limits.MaxFormPartBytes)
+	}
+	return nil
+}
+
+// formName returns the name and filename parameters of the part's
+// Content-Disposition, if it is form-data.
+func (p *part) formName() (string, string) {
+	cd, ok := p.header.Get("Content-Disposition")
+	if !ok {
+		return "", ""
+	}
+	disposition, params, err := mime.ParseMediaType(cd)
+	if err != nil || disposition != "form-data" {
+		return "", ""
+	}
+	filename := params["filename"]
+	if filename != "" {
+		filename = filepath.Base(filename)
+	}
+	return params["name"], filename
+}
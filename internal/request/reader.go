@@ -0,0 +1,105 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/iferdel-vault/tcptohttp/internal/headers"
+)
+
+// Reader parses requests from a connection. Bytes it has buffered past the
+// end of the current request are kept for the next one.
+type Reader struct {
+	// Limits applies to every request read after it is set.
+	Limits      Limits
+	reader      io.Reader
+	buf         []byte
+	readToIndex int
+	err         error
+	current     *Request
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		Limits: DefaultLimits,
+		reader: reader,
+		buf:    make([]byte, buffSize),
+	}
+}
+
+// ReadRequest parses the request line and the header section and returns as
+// soon as they are complete. The body stays on the connection until it is
+// read through the request's BodyReader. It returns io.EOF if the connection
+// was closed before any byte of a new request arrived. The body of the
+// previous request must be fully read before the next one can be parsed.
+func (rr *Reader) ReadRequest() (*Request, error) {
+	if rr.current != nil && rr.current.state != requestStateDone {
+		return nil, errors.New("previous request body was not fully read")
+	}
+	req := &Request{
+		state:    requestStateInitialized,
+		Headers:  headers.NewHeaders(),
+		Body:     make([]byte, 0),
+		Trailers: headers.NewHeaders(),
+		limits:   rr.Limits,
+	}
+	for {
+		numBytesParsed, err := req.parse(rr.buf[:rr.readToIndex])
+		if err != nil {
+			return nil, err
+		}
+		rr.discard(numBytesParsed)
+		if req.headersDone() {
+			break
+		}
+
+		err = rr.fill()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				if req.state == requestStateInitialized && rr.readToIndex == 0 {
+					return nil, io.EOF
+				}
+				return nil, fmt.Errorf("%w: in state: %d, unparsed bytes on EOF: %d", ErrIncompleteRequest, req.state, rr.readToIndex)
+			}
+			return nil, err
+		}
+	}
+	req.BodyReader = &body{req: req, rr: rr}
+	rr.current = req
+	return req, nil
+}
+
+// Buffered returns the number of bytes read from the connection past the
+// current request.
+func (rr *Reader) Buffered() int {
+	return rr.readToIndex
+}
+
+// fill reads more data from the connection into the buffer, growing the
+// buffer when it is full.
+func (rr *Reader) fill() error {
+	if rr.err != nil {
+		return rr.err
+	}
+	if rr.readToIndex >= len(rr.buf) {
+		newBuf := make([]byte, len(rr.buf)*2)
+		copy(newBuf, rr.buf)
+		rr.buf = newBuf
+	}
+	numBytesRead, err := rr.reader.Read(rr.buf[rr.readToIndex:])
+	rr.readToIndex += numBytesRead
+	if err != nil {
+		rr.err = err
+		if numBytesRead > 0 {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (rr *Reader) discard(n int) {
+	copy(rr.buf, rr.buf[n:rr.readToIndex])
+	rr.readToIndex -= n
+}
@@ -5,23 +5,39 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"strconv"
 	"strings"
 
 	"github.com/iferdel-vault/tcptohttp/internal/headers"
 )
 
 type Request struct {
-	RequestLine    RequestLine
-	Headers        headers.Headers
-	Body           []byte
+	RequestLine RequestLine
+	Headers     *headers.Headers
+	// Body holds the whole body once it has been buffered by ReadBody or
+	// RequestFromReader.
+	Body []byte
+	// BodyReader streams the body from the connection as it is read.
+	BodyReader io.ReadCloser
+	Trailers   *headers.Headers
+	// Form, PostForm and MultipartForm are filled by ParseForm and
+	// ParseMultipartForm.
+	Form           Values
+	PostForm       Values
+	MultipartForm  *MultipartForm
 	state          requestState
 	bodyLengthRead int
+	contentLength  int
+	chunkRemaining int
+	limits         Limits
+	fieldBytes     int
+	fieldCount     int
+	continueFunc   func() error
 }
 
 type RequestLine struct {
 	HttpVersion   string
 	RequestTarget string
+	Target        Target
 	Method        string
 }
 
@@ -31,48 +47,64 @@ const (
 	requestStateInitialized requestState = iota
 	requestStateParsingHeaders
 	requestStateParsingBody
+	requestStateParsingChunkSize
+	requestStateParsingChunkData
+	requestStateParsingChunkDataEnd
+	requestStateParsingTrailers
 	requestStateDone
 )
 
 const crlf = "\r\n"
 const buffSize = 8
 
+// RequestFromReader parses a single request from reader and buffers its
+// whole body into Body.
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, buffSize, buffSize)
-	readToIndex := 0
-	req := &Request{
-		state:   requestStateInitialized,
-		Headers: headers.NewHeaders(),
-		Body:    make([]byte, 0),
-	}
-	for req.state != requestStateDone {
-		if readToIndex >= len(buf) {
-			newBuf := make([]byte, len(buf)*2)
-			copy(newBuf, buf)
-			buf = newBuf
-		}
-
-		numBytesRead, err := reader.Read(buf[readToIndex:])
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				if req.state != requestStateDone {
-					return nil, fmt.Errorf("incomplete request, in state: %d, read n bytes on EOF: %d", req.state, numBytesRead)
-				}
-				break
-			}
-			return nil, err
+	req, err := NewReader(reader).ReadRequest()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: no data before EOF", ErrIncompleteRequest)
 		}
-		readToIndex += numBytesRead
+		return nil, err
+	}
+	_, err = req.ReadBody()
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
 
-		numBytesParsed, err := req.parse(buf[:readToIndex])
-		if err != nil {
-			return nil, err
-		}
+// ReadBody reads the rest of the body into Body and returns it.
+func (r *Request) ReadBody() ([]byte, error) {
+	b, err := io.ReadAll(r.BodyReader)
+	r.Body = append(r.Body, b...)
+	return r.Body, err
+}
 
-		copy(buf, buf[numBytesParsed:])
-		readToIndex -= numBytesParsed
+// KeepAlive reports whether the client allows the connection to be reused
+// after this request. HTTP/1.0 clients have to ask for it.
+func (r *Request) KeepAlive() bool {
+	if r.Headers.HasToken("Connection", "close") {
+		return false
 	}
-	return req, nil
+	if r.RequestLine.HttpVersion == "1.0" {
+		return r.Headers.HasToken("Connection", "keep-alive")
+	}
+	return true
+}
+
+// ExpectsContinue reports whether the client sent "Expect: 100-continue"
+// and waits for an interim response before sending the body. HTTP/1.0
+// clients cannot expect it.
+func (r *Request) ExpectsContinue() bool {
+	return r.RequestLine.HttpVersion != "1.0" && r.Headers.HasToken("Expect", "100-continue")
+}
+
+// SetContinue registers fn to be called right before the body is first
+// read from the connection, if the client expects a 100 (Continue). A
+// handler that never reads the body lets the server reject it early.
+func (r *Request) SetContinue(fn func() error) {
+	r.continueFunc = fn
 }
 
 func parseRequestLine(data []byte) (*RequestLine, int, error) {
@@ -91,43 +123,73 @@ func parseRequestLine(data []byte) (*RequestLine, int, error) {
 func requestLineFromString(str string) (*RequestLine, error) {
 	parts := strings.Split(str, " ")
 	if len(parts) != 3 {
-		return nil, fmt.Errorf("poorly formatted request-line: %s", str)
+		return nil, fmt.Errorf("%w: %s", ErrMalformedRequestLine, str)
 	}
 
 	method := parts[0]
 	for _, c := range method {
 		if c < 'A' || c > 'Z' {
-			return nil, fmt.Errorf("invalid method: %s", method)
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMethod, method)
 		}
 	}
 
 	requestTarget := parts[1]
+	target, err := parseTarget(method, requestTarget)
+	if err != nil {
+		return nil, err
+	}
 
 	httpVersionParts := strings.Split(parts[2], "/")
 	if len(httpVersionParts) != 2 {
-		return nil, fmt.Errorf("malformed start-line: %s", str)
+		return nil, fmt.Errorf("%w: %s", ErrMalformedRequestLine, str)
 	}
 
 	httpPart := httpVersionParts[0]
 	if httpPart != "HTTP" {
-		return nil, fmt.Errorf("unrecognized HTTP-version: %s", httpPart)
+		return nil, fmt.Errorf("%w: unrecognized HTTP-name: %s", ErrMalformedRequestLine, httpPart)
 	}
 	version := httpVersionParts[1]
-	if version != "1.1" {
-		return nil, fmt.Errorf("unrecognized HTTP-version: %s", version)
+	if !validVersion(version) {
+		return nil, fmt.Errorf("%w: malformed HTTP-version: %s", ErrMalformedRequestLine, version)
+	}
+	switch {
+	case version == "1.0" || version == "1.1":
+	case strings.HasPrefix(version, "1."):
+		// RFC 9110 §2.5: a later minor version is handled as the highest
+		// one supported
+		version = "1.1"
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedVersion, version)
 	}
 
 	return &RequestLine{
 		HttpVersion:   version,
 		RequestTarget: requestTarget,
+		Target:        target,
 		Method:        method,
 	}, nil
 
 }
 
+// validVersion reports whether version is DIGIT "." DIGIT, or a bare DIGIT
+// as sent by HTTP/2 and HTTP/3 clients.
+func validVersion(version string) bool {
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	switch len(version) {
+	case 1:
+		return isDigit(version[0])
+	case 3:
+		return isDigit(version[0]) && version[1] == '.' && isDigit(version[2])
+	default:
+		return false
+	}
+}
+
+// parse consumes the request line and the header section. The body is
+// left for BodyReader.
 func (r *Request) parse(data []byte) (int, error) {
 	var totalBytesParsed int
-	for r.state != requestStateDone {
+	for !r.headersDone() {
 		n, err := r.parseSingle(data[totalBytesParsed:])
 		if err != nil {
 			return 0, err
@@ -150,43 +212,58 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		}
 		if n == 0 {
 			// just need more data
-			return 0, nil
+			return 0, r.checkRequestLine(len(data))
+		}
+		err = r.checkRequestLine(n)
+		if err != nil {
+			return 0, err
 		}
 		r.RequestLine = *rl
 		r.state = requestStateParsingHeaders
 		return n, nil
 	case requestStateParsingHeaders:
-		n, done, err := r.Headers.Parse(data)
+		n, done, err := r.parseField(r.Headers, data)
 		if err != nil {
 			return 0, err
 		}
 		if done {
-			r.state = requestStateParsingBody
+			err = r.startBody()
+			if err != nil {
+				return 0, err
+			}
 		}
 		return n, nil
-	case requestStateParsingBody:
-		clStr, ok := r.Headers.Get("Content-Length")
-		if !ok {
-			// assume that if no content-length header is present, there is no body
-			r.state = requestStateDone
-			return len(data), nil
-		}
-		cl, err := strconv.Atoi(clStr)
-		if err != nil {
-			return 0, fmt.Errorf("malformed Content-Length: %s", err)
-		}
-		r.Body = append(r.Body, data...)
-		r.bodyLengthRead += len(data)
-		if r.bodyLengthRead > cl {
-			return 0, errors.New("body length is greater than reported content-length")
-		}
-		if r.bodyLengthRead == cl {
-			r.state = requestStateDone
-		}
-		return len(data), nil
-	case requestStateDone:
-		return 0, errors.New("error: trying to read data in a done state")
 	default:
-		return 0, errors.New("error: unknown state")
+		return 0, fmt.Errorf("error: trying to parse request head in state: %d", r.state)
 	}
 }
+
+// parseField parses one field line of the header or trailer section into h,
+// enforcing the header limits.
+func (r *Request) parseField(h *headers.Headers, data []byte) (int, bool, error) {
+	if len(data) > 0 && (data[0] == ' ' || data[0] == '\t') {
+		// RFC 9112 §2.2: a whitespace-preceded first line may be dropped by
+		// a front end; any later one is obs-fold
+		return 0, false, fmt.Errorf("%w: leading whitespace", headers.ErrMalformedFieldLine)
+	}
+	n, done, err := h.Parse(data)
+	if err != nil {
+		return 0, false, err
+	}
+	if n == 0 {
+		return 0, false, r.checkFields(len(data))
+	}
+	r.fieldBytes += n
+	if !done {
+		r.fieldCount++
+	}
+	err = r.checkFields(0)
+	if err != nil {
+		return 0, false, err
+	}
+	return n, done, nil
+}
+
+func (r *Request) headersDone() bool {
+	return r.state >= requestStateParsingBody
+}
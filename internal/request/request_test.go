@@ -2,8 +2,12 @@ package request
 
 import (
 	"io"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/iferdel-vault/tcptohttp/internal/headers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -34,7 +38,7 @@ func TestBodyParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "0", r.Headers["content-length"])
+	assert.Equal(t, "0", headerValue(r.Headers, "content-length"))
 
 	// Test: Empty Body, no reported content length
 	reader = &chunkReader{
@@ -71,6 +75,404 @@ func TestBodyParse(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestChunkedBodyParse(t *testing.T) {
+	// Test: Standard Chunked Body
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\n" +
+			"hello\r\n" +
+			"7\r\n" +
+			" world!\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!", string(r.Body))
+
+	// Test: Chunk Extensions and Uppercase Hex Size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"A;name=value\r\n" +
+			"0123456789\r\n" +
+			"1 ; last;quoted=\"a;\\\"b\" ; x = y\r\n" +
+			"!\r\n" +
+			"0;done\r\n" +
+			"\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "0123456789!", string(r.Body))
+
+	// Test: Trailer Section
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum\r\n" +
+			"\r\n" +
+			"4\r\n" +
+			"data\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "data", string(r.Body))
+	assert.Equal(t, "abc123", headerValue(r.Trailers, "x-checksum"))
+
+	// Test: Empty Chunked Body
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Empty(t, r.Body)
+
+	// Test: Malformed Chunk Size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\n" +
+			"hello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "malformed chunk size")
+
+	// Test: Bare LF in Chunk Extension
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"2;\nxx\r\n" +
+			"hi\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrMalformedChunk)
+	assert.Contains(t, err.Error(), "malformed chunk extension")
+
+	// Test: Control Character in Chunk Extension
+	for _, ext := range []string{"2;a=\x01", "2;a=\"\x01\"", "2;a=\"b", "2;=b", "2;a b", "2 x"} {
+		reader = &chunkReader{
+			data: "POST /submit HTTP/1.1\r\n" +
+				"Host: localhost:42069\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				ext + "\r\n" +
+				"hi\r\n" +
+				"0\r\n" +
+				"\r\n",
+			numBytesPerRead: 3,
+		}
+		_, err = RequestFromReader(reader)
+		require.ErrorIs(t, err, ErrMalformedChunk, ext)
+	}
+
+	// Test: Chunk Size Overflow
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"fffffffffffffffff\r\n" +
+			"hello\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Chunk Data Longer Than Chunk Size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\n" +
+			"hello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Missing Last Chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\n" +
+			"hello\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestStreamingBody(t *testing.T) {
+	// Test: Request Returned Before Body Arrives
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("POST /upload HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 11\r\n\r\n"))
+	}()
+	r, err := NewReader(pr).ReadRequest()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "POST", r.RequestLine.Method)
+	assert.Empty(t, r.Body)
+	go func() {
+		pw.Write([]byte("hello "))
+		pw.Write([]byte("world"))
+	}()
+	b, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(b))
+
+	// Test: Chunked Body Read in Small Pieces
+	reader := &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\nhello \r\n" +
+			"5\r\nworld\r\n" +
+			"0\r\n\r\n",
+		numBytesPerRead: 7,
+	}
+	r, err = NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	p := make([]byte, 2)
+	var got []byte
+	for {
+		n, err := r.BodyReader.Read(p)
+		got = append(got, p[:n]...)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "hello world", string(got))
+
+	// Test: Opt-in Buffered Body
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n",
+		numBytesPerRead: 3,
+	}
+	r, err = NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	b, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(b))
+	assert.Equal(t, "hello world!\n", string(r.Body))
+
+	// Test: Body Cut Short
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 20\r\n" +
+			"\r\n" +
+			"partial content",
+		numBytesPerRead: 3,
+	}
+	r, err = NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.BodyReader)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Read After Close
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 3,
+	}
+	r, err = NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	require.NoError(t, r.BodyReader.Close())
+	_, err = r.BodyReader.Read(p)
+	require.Error(t, err)
+	assert.Equal(t, 5, r.UnreadBodyLength())
+
+	// Test: Discard After Close
+	assert.True(t, r.DiscardBody(5))
+	assert.Equal(t, 0, r.UnreadBodyLength())
+
+	// Test: Discard Over The Limit
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"a\r\n0123456789\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, -1, r.UnreadBodyLength())
+	assert.False(t, r.DiscardBody(5))
+}
+
+func TestPipelinedRequests(t *testing.T) {
+	// Test: Pipelined Requests on One Connection
+	reader := &chunkReader{
+		data: "POST /first HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"POST /second HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nworld\r\n0\r\n\r\n" +
+			"GET /third HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Connection: close\r\n" +
+			"\r\n",
+		numBytesPerRead: 64,
+	}
+	rr := NewReader(reader)
+	r, err := rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/first", r.RequestLine.RequestTarget)
+	b, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+	assert.True(t, r.KeepAlive())
+
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/second", r.RequestLine.RequestTarget)
+	b, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(b))
+
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/third", r.RequestLine.RequestTarget)
+	assert.False(t, r.KeepAlive())
+	_, err = rr.ReadRequest()
+	require.ErrorIs(t, err, io.EOF)
+
+	// Test: Next Request Before Body Is Read
+	reader = &chunkReader{
+		data: "POST /first HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /second HTTP/1.1\r\n" +
+			"\r\n",
+		numBytesPerRead: 64,
+	}
+	rr = NewReader(reader)
+	_, err = rr.ReadRequest()
+	require.NoError(t, err)
+	_, err = rr.ReadRequest()
+	require.Error(t, err)
+}
+
+func TestExpectContinue(t *testing.T) {
+	// Test: Continue Sent on First Body Read
+	reader := &chunkReader{
+		data: "PUT /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"Expect: 100-continue\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 3,
+	}
+	r, err := NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	assert.True(t, r.ExpectsContinue())
+	calls := 0
+	r.SetContinue(func() error {
+		calls++
+		return nil
+	})
+	assert.Equal(t, 0, calls)
+	b, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(b))
+	assert.Equal(t, 1, calls)
+
+	// Test: Continue Error Fails the Read
+	reader = &chunkReader{
+		data: "PUT /upload HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"Expect: 100-continue\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 3,
+	}
+	r, err = NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	r.SetContinue(func() error {
+		return io.ErrClosedPipe
+	})
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, io.ErrClosedPipe)
+
+	// Test: HTTP/1.0 Clients Cannot Expect Continue
+	reader = &chunkReader{
+		data: "PUT /upload HTTP/1.0\r\n" +
+			"Content-Length: 5\r\n" +
+			"Expect: 100-continue\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 3,
+	}
+	r, err = NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	assert.False(t, r.ExpectsContinue())
+	calls = 0
+	r.SetContinue(func() error {
+		calls++
+		return nil
+	})
+	_, err = r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, 0, calls)
+}
+
 func TestRequestLineHeaderParse(t *testing.T) {
 	// Test: Standard Headers
 	reader := &chunkReader{
@@ -80,9 +482,9 @@ func TestRequestLineHeaderParse(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", headerValue(r.Headers, "host"))
+	assert.Equal(t, "curl/7.81.0", headerValue(r.Headers, "user-agent"))
+	assert.Equal(t, "*/*", headerValue(r.Headers, "accept"))
 
 	// Test: Case Insensitive Headers
 	reader = &chunkReader{
@@ -92,9 +494,9 @@ func TestRequestLineHeaderParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", headerValue(r.Headers, "host"))
+	assert.Equal(t, "curl/7.81.0", headerValue(r.Headers, "user-agent"))
+	assert.Equal(t, "*/*", headerValue(r.Headers, "accept"))
 
 	// Test: Duplicate Headers
 	reader = &chunkReader{
@@ -104,9 +506,9 @@ func TestRequestLineHeaderParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069, localhost:5432", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069, localhost:5432", headerValue(r.Headers, "host"))
+	assert.Equal(t, "curl/7.81.0", headerValue(r.Headers, "user-agent"))
+	assert.Equal(t, "*/*", headerValue(r.Headers, "accept"))
 
 	// Test: Empty Headers
 	reader = &chunkReader{
@@ -116,7 +518,7 @@ func TestRequestLineHeaderParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Empty(t, r.Headers)
+	assert.Equal(t, 0, r.Headers.Len())
 
 	// Test: Malformed Header: Missing Colon
 	reader = &chunkReader{
@@ -205,6 +607,758 @@ func TestRequestLineParse(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestHttpVersionParse(t *testing.T) {
+	// Test: HTTP/1.0 Request
+	reader := &chunkReader{
+		data:            "GET / HTTP/1.0\r\nUser-Agent: ApacheBench/2.3\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+	assert.False(t, r.KeepAlive())
+
+	// Test: HTTP/1.0 Request Asking for Keep-alive
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.0\r\nConnection: Keep-Alive\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.True(t, r.KeepAlive())
+
+	// Test: HTTP/1.2 Is Handled as HTTP/1.1
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.2\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
+	assert.True(t, r.KeepAlive())
+
+	// Test: HTTP/2.0 Is Not Supported
+	reader = &chunkReader{
+		data:            "GET / HTTP/2.0\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	// Test: HTTP/3 Is Not Supported
+	reader = &chunkReader{
+		data:            "GET / HTTP/3\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	// Test: Malformed Version
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrMalformedRequestLine)
+}
+
+func TestRequestTargetParse(t *testing.T) {
+	// Test: Origin-form with Query
+	reader := &chunkReader{
+		data:            "GET /search/caf%C3%A9%2Fbar?q=hello+world&tag=a&tag=b%26c&empty= HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	target := r.RequestLine.Target
+	assert.Equal(t, TargetFormOrigin, target.Form)
+	assert.Equal(t, "/search/café/bar", target.Path)
+	assert.Equal(t, "/search/caf%C3%A9%2Fbar", target.RawPath)
+	assert.Equal(t, "q=hello+world&tag=a&tag=b%26c&empty=", target.RawQuery)
+	assert.Equal(t, "hello world", target.Query.Get("q"))
+	assert.Equal(t, []string{"a", "b&c"}, target.Query["tag"])
+	assert.Equal(t, "", target.Query.Get("empty"))
+	assert.Equal(t, "/search/caf%C3%A9%2Fbar?q=hello+world&tag=a&tag=b%26c&empty=", r.RequestLine.RequestTarget)
+
+	// Test: Absolute-form
+	reader = &chunkReader{
+		data:            "GET http://www.example.org/pub/WWW/TheProject.html?x=1 HTTP/1.1\r\nHost: www.example.org\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	target = r.RequestLine.Target
+	assert.Equal(t, TargetFormAbsolute, target.Form)
+	assert.Equal(t, "http", target.Scheme)
+	assert.Equal(t, "www.example.org", target.Host)
+	assert.Equal(t, "/pub/WWW/TheProject.html", target.Path)
+	assert.Equal(t, "1", target.Query.Get("x"))
+
+	// Test: Absolute-form without Path
+	reader = &chunkReader{
+		data:            "GET http://www.example.org HTTP/1.1\r\nHost: www.example.org\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/", r.RequestLine.Target.Path)
+
+	// Test: Authority-form
+	reader = &chunkReader{
+		data:            "CONNECT www.example.com:80 HTTP/1.1\r\nHost: www.example.com\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, TargetFormAuthority, r.RequestLine.Target.Form)
+	assert.Equal(t, "www.example.com:80", r.RequestLine.Target.Host)
+
+	// Test: Asterisk-form
+	reader = &chunkReader{
+		data:            "OPTIONS * HTTP/1.1\r\nHost: www.example.com\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, TargetFormAsterisk, r.RequestLine.Target.Form)
+
+	// Test: Asterisk-form on a Method Other Than OPTIONS
+	reader = &chunkReader{
+		data:            "GET * HTTP/1.1\r\nHost: www.example.com\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Invalid Percent-encoding in Path
+	reader = &chunkReader{
+		data:            "GET /bad%zzpath HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Truncated Percent-encoding in Query
+	reader = &chunkReader{
+		data:            "GET /path?q=%4 HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Fragment in Request-target
+	reader = &chunkReader{
+		data:            "GET /path#section HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Unrecognized Form
+	reader = &chunkReader{
+		data:            "GET path HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestRequestLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineBytes: 32,
+		MaxHeaderBytes:      64,
+		MaxHeaderCount:      3,
+		MaxBodyBytes:        10,
+	}
+
+	// Test: Request Within Limits
+	rr := NewReader(&chunkReader{
+		data:            "POST /upload HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\n0123456789",
+		numBytesPerRead: 3,
+	})
+	rr.Limits = limits
+	r, err := rr.ReadRequest()
+	require.NoError(t, err)
+	b, err := r.ReadBody()
+	require.NoError(t, err)
+	assert.Equal(t, "0123456789", string(b))
+
+	// Test: Request-line Too Long Stops Reading
+	reader := &chunkReader{
+		data:            "GET /" + strings.Repeat("a", 1000) + " HTTP/1.1\r\nHost: localhost\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	rr = NewReader(reader)
+	rr.Limits = limits
+	_, err = rr.ReadRequest()
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+	assert.Less(t, reader.pos, 64)
+
+	// Test: Header Section Too Large
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nX-Big: " + strings.Repeat("a", 1000) + "\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	rr = NewReader(reader)
+	rr.Limits = limits
+	_, err = rr.ReadRequest()
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+	assert.Less(t, reader.pos, 128)
+
+	// Test: Too Many Header Fields
+	rr = NewReader(&chunkReader{
+		data:            "GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	rr.Limits = limits
+	_, err = rr.ReadRequest()
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+
+	// Test: Content-Length Over Body Limit
+	rr = NewReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: 11\r\n\r\n01234567890",
+		numBytesPerRead: 3,
+	})
+	rr.Limits = limits
+	_, err = rr.ReadRequest()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked Body Over Body Limit
+	rr = NewReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n6\r\n012345\r\n6\r\n678901\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	rr.Limits = limits
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Trailers Count Toward Header Limits
+	rr = NewReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nA: 1\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nB: 2\r\nC: 3\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	rr.Limits = limits
+	r, err = rr.ReadRequest()
+	require.NoError(t, err)
+	_, err = r.ReadBody()
+	require.ErrorIs(t, err, ErrHeadersTooLarge)
+}
+
+func TestParseErrors(t *testing.T) {
+	// Test: Malformed Request-line
+	_, err := RequestFromReader(&chunkReader{
+		data:            "GET /\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	require.ErrorIs(t, err, ErrMalformedRequestLine)
+	var requestErr *Error
+	require.ErrorAs(t, err, &requestErr)
+	assert.Equal(t, 400, requestErr.StatusCode)
+
+	// Test: Invalid Method
+	_, err = RequestFromReader(&chunkReader{
+		data:            "get / HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	require.ErrorIs(t, err, ErrInvalidMethod)
+
+	// Test: Unsupported Version
+	_, err = RequestFromReader(&chunkReader{
+		data:            "GET / HTTP/2.0\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	require.ErrorIs(t, err, ErrUnsupportedVersion)
+	require.ErrorAs(t, err, &requestErr)
+	assert.Equal(t, 505, requestErr.StatusCode)
+
+	// Test: Invalid Header Name Surfaces the Headers Error
+	_, err = RequestFromReader(&chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost : localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	require.ErrorIs(t, err, headers.ErrInvalidHeaderName)
+
+	// Test: Incomplete Request
+	_, err = RequestFromReader(&chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\n",
+		numBytesPerRead: 3,
+	})
+	require.ErrorIs(t, err, ErrIncompleteRequest)
+
+	// Test: Incomplete Body
+	_, err = RequestFromReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: 10\r\n\r\nshort",
+		numBytesPerRead: 3,
+	})
+	require.ErrorIs(t, err, ErrIncompleteRequest)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Malformed Content-Length
+	_, err = RequestFromReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: ten\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	require.ErrorIs(t, err, ErrMalformedContentLength)
+
+	// Test: Malformed Chunk
+	_, err = RequestFromReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nxyz\r\n",
+		numBytesPerRead: 3,
+	})
+	require.ErrorIs(t, err, ErrMalformedChunk)
+
+	// Test: Unsupported Transfer-coding
+	_, err = RequestFromReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	require.ErrorIs(t, err, ErrUnsupportedTransferCoding)
+	require.ErrorAs(t, err, &requestErr)
+	assert.Equal(t, 501, requestErr.StatusCode)
+
+	// Test: Invalid Request-target
+	_, err = RequestFromReader(&chunkReader{
+		data:            "GET /%zz HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	require.ErrorIs(t, err, ErrInvalidTarget)
+}
+
+func TestRequestSmuggling(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers string
+		body    string
+		wantErr error
+	}{
+		{
+			name:    "CL.TE",
+			headers: "Content-Length: 13\r\nTransfer-Encoding: chunked\r\n",
+			body:    "0\r\n\r\nSMUGGLED",
+			wantErr: ErrInvalidFraming,
+		},
+		{
+			name:    "TE.CL",
+			headers: "Transfer-Encoding: chunked\r\nContent-Length: 3\r\n",
+			body:    "8\r\nSMUGGLED\r\n0\r\n\r\n",
+			wantErr: ErrInvalidFraming,
+		},
+		{
+			name:    "TE.TE duplicate chunked",
+			headers: "Transfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n",
+			body:    "0\r\n\r\n",
+			wantErr: ErrInvalidFraming,
+		},
+		{
+			name:    "TE.TE obfuscated coding",
+			headers: "Transfer-Encoding: chunked\r\nTransfer-Encoding: x\r\n",
+			body:    "0\r\n\r\n",
+			wantErr: ErrUnsupportedTransferCoding,
+		},
+		{
+			name:    "chunked not last",
+			headers: "Transfer-Encoding: chunked, gzip\r\n",
+			body:    "0\r\n\r\n",
+			wantErr: ErrUnsupportedTransferCoding,
+		},
+		{
+			name:    "unknown coding before chunked",
+			headers: "Transfer-Encoding: gzip, chunked\r\n",
+			body:    "0\r\n\r\n",
+			wantErr: ErrUnsupportedTransferCoding,
+		},
+		{
+			name:    "identity coding",
+			headers: "Transfer-Encoding: identity\r\n",
+			body:    "",
+			wantErr: ErrUnsupportedTransferCoding,
+		},
+		{
+			name:    "lookalike coding",
+			headers: "Transfer-Encoding: xchunked\r\n",
+			body:    "0\r\n\r\n",
+			wantErr: ErrUnsupportedTransferCoding,
+		},
+		{
+			name:    "empty Transfer-Encoding",
+			headers: "Transfer-Encoding: \r\nContent-Length: 5\r\n",
+			body:    "hello",
+			wantErr: ErrInvalidFraming,
+		},
+		{
+			name:    "space before colon",
+			headers: "Transfer-Encoding : chunked\r\nContent-Length: 5\r\n",
+			body:    "hello",
+			wantErr: headers.ErrInvalidHeaderName,
+		},
+		{
+			name:    "tab before colon",
+			headers: "Transfer-Encoding\t: chunked\r\nContent-Length: 5\r\n",
+			body:    "hello",
+			wantErr: headers.ErrInvalidHeaderName,
+		},
+		{
+			name:    "obs-fold",
+			headers: " Transfer-Encoding: chunked\r\nContent-Length: 5\r\n",
+			body:    "hello",
+			wantErr: headers.ErrMalformedFieldLine,
+		},
+		{
+			name:    "obs-fold with tab",
+			headers: "\tTransfer-Encoding: chunked\r\n",
+			body:    "0\r\n\r\n",
+			wantErr: headers.ErrMalformedFieldLine,
+		},
+		{
+			name:    "bare LF in header value",
+			headers: "X-Foo: a\nTransfer-Encoding: chunked\r\nContent-Length: 5\r\n",
+			body:    "hello",
+			wantErr: headers.ErrInvalidHeaderValue,
+		},
+		{
+			name:    "NUL in header value",
+			headers: "X-Foo: a\x00b\r\nContent-Length: 5\r\n",
+			body:    "hello",
+			wantErr: headers.ErrInvalidHeaderValue,
+		},
+		{
+			name:    "conflicting Content-Length fields",
+			headers: "Content-Length: 5\r\nContent-Length: 6\r\n",
+			body:    "hello!",
+			wantErr: ErrMalformedContentLength,
+		},
+		{
+			name:    "conflicting Content-Length list",
+			headers: "Content-Length: 5, 6\r\n",
+			body:    "hello!",
+			wantErr: ErrMalformedContentLength,
+		},
+		{
+			name:    "plus sign in Content-Length",
+			headers: "Content-Length: +5\r\n",
+			body:    "hello",
+			wantErr: ErrMalformedContentLength,
+		},
+		{
+			name:    "minus sign in Content-Length",
+			headers: "Content-Length: -5\r\n",
+			body:    "hello",
+			wantErr: ErrMalformedContentLength,
+		},
+		{
+			name:    "hex Content-Length",
+			headers: "Content-Length: 0x5\r\n",
+			body:    "hello",
+			wantErr: ErrMalformedContentLength,
+		},
+		{
+			name:    "space inside Content-Length",
+			headers: "Content-Length: 1 2\r\n",
+			body:    "hello world!",
+			wantErr: ErrMalformedContentLength,
+		},
+		{
+			name:    "overflowing Content-Length",
+			headers: "Content-Length: 99999999999999999999\r\n",
+			body:    "hello",
+			wantErr: ErrMalformedContentLength,
+		},
+		{
+			name:    "negative chunk size",
+			headers: "Transfer-Encoding: chunked\r\n",
+			body:    "-5\r\nhello\r\n0\r\n\r\n",
+			wantErr: ErrMalformedChunk,
+		},
+		{
+			name:    "hex prefix in chunk size",
+			headers: "Transfer-Encoding: chunked\r\n",
+			body:    "0x5\r\nhello\r\n0\r\n\r\n",
+			wantErr: ErrMalformedChunk,
+		},
+		{
+			name:    "chunk data past chunk size",
+			headers: "Transfer-Encoding: chunked\r\n",
+			body:    "3\r\nhello\r\n0\r\n\r\n",
+			wantErr: ErrMalformedChunk,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := &chunkReader{
+				data:            "POST / HTTP/1.1\r\nHost: localhost:42069\r\n" + tc.headers + "\r\n" + tc.body,
+				numBytesPerRead: 3,
+			}
+			_, err := RequestFromReader(reader)
+			require.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+
+	// Test: Transfer-Encoding in an HTTP/1.0 Request
+	reader := &chunkReader{
+		data:            "POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err := RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrInvalidFraming)
+
+	// Test: Whitespace Before the First Field Line
+	for _, data := range []string{
+		"POST / HTTP/1.1\r\n Transfer-Encoding: chunked\r\nHost: x\r\n\r\n0\r\n\r\n",
+		"POST / HTTP/1.1\r\n\tContent-Length: 5\r\nHost: x\r\n\r\nhello",
+		"POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n Content-Length: 5\r\n\r\n",
+	} {
+		reader = &chunkReader{
+			data:            data,
+			numBytesPerRead: 3,
+		}
+		_, err = RequestFromReader(reader)
+		require.ErrorIs(t, err, headers.ErrMalformedFieldLine, data)
+	}
+
+	// Test: Repeated Identical Content-Length
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+
+	// Test: Case-insensitive Chunked Coding
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nTransfer-Encoding: Chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+}
+
+func TestParseForm(t *testing.T) {
+	// Test: URL-encoded Body and Query
+	reader := &chunkReader{
+		data: "POST /submit?source=query&name=fromquery HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Type: application/x-www-form-urlencoded\r\n" +
+			"Content-Length: 33\r\n" +
+			"\r\n" +
+			"name=Ada+Lovelace&lang=en%2Dus&x=",
+		numBytesPerRead: 3,
+	}
+	r, err := NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, "Ada Lovelace", r.PostForm.Get("name"))
+	assert.Equal(t, "en-us", r.PostForm.Get("lang"))
+	assert.Equal(t, "", r.PostForm.Get("source"))
+	assert.Equal(t, []string{"Ada Lovelace", "fromquery"}, r.Form["name"])
+	assert.Equal(t, "query", r.FormValue("source"))
+	assert.Equal(t, "Ada Lovelace", r.PostFormValue("name"))
+
+	// Test: GET Body Is Not Parsed
+	reader = &chunkReader{
+		data: "GET /search?q=go HTTP/1.1\r\n" +
+			"Content-Type: application/x-www-form-urlencoded\r\n" +
+			"Content-Length: 3\r\n" +
+			"\r\n" +
+			"a=b",
+		numBytesPerRead: 3,
+	}
+	r, err = NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	require.NoError(t, r.ParseForm())
+	assert.Equal(t, "go", r.Form.Get("q"))
+	assert.Equal(t, "", r.Form.Get("a"))
+
+	// Test: Malformed URL-encoded Body
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Type: application/x-www-form-urlencoded\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"a=%zz",
+		numBytesPerRead: 3,
+	}
+	r, err = NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	require.ErrorIs(t, r.ParseForm(), ErrMalformedForm)
+}
+
+func TestParseMultipartForm(t *testing.T) {
+	body := "preamble to ignore\r\n" +
+		"--XyZ\r\n" +
+		"Content-Disposition: form-data; name=\"title\"\r\n" +
+		"\r\n" +
+		"Quarterly report\r\n" +
+		"--XyZ \t\r\n" +
+		"Content-Disposition: form-data; name=\"upload\"; filename=\"../../report.csv\"\r\n" +
+		"Content-Type: text/csv\r\n" +
+		"\r\n" +
+		"a,b\r\n1,2\r\n--XyZnot a boundary\r\n" +
+		"--XyZ\r\n" +
+		"Content-Disposition: form-data; name=\"upload\"; filename=\"big.bin\"\r\n" +
+		"\r\n" +
+		strings.Repeat("x", 5000) + "\r\n" +
+		"--XyZ--\r\n" +
+		"epilogue"
+	newRequest := func() *Request {
+		reader := &chunkReader{
+			data: "POST /upload?id=7 HTTP/1.1\r\n" +
+				"Host: localhost:42069\r\n" +
+				"Content-Type: multipart/form-data; boundary=XyZ\r\n" +
+				"Content-Length: " + strconv.Itoa(len(body)) + "\r\n" +
+				"\r\n" +
+				body,
+			numBytesPerRead: 7,
+		}
+		r, err := NewReader(reader).ReadRequest()
+		require.NoError(t, err)
+		return r
+	}
+
+	// Test: Fields and Files, Spilling to Disk Past the Memory Limit
+	r := newRequest()
+	require.NoError(t, r.ParseMultipartForm(1024))
+	defer r.MultipartForm.RemoveAll()
+	assert.Equal(t, "Quarterly report", r.FormValue("title"))
+	assert.Equal(t, "Quarterly report", r.PostForm.Get("title"))
+	assert.Equal(t, "7", r.Form.Get("id"))
+	files := r.MultipartForm.File["upload"]
+	require.Len(t, files, 2)
+
+	assert.Equal(t, "report.csv", files[0].Filename)
+	ct, _ := files[0].Header.Get("Content-Type")
+	assert.Equal(t, "text/csv", ct)
+	f, err := files[0].Open()
+	require.NoError(t, err)
+	b, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "a,b\r\n1,2\r\n--XyZnot a boundary", string(b))
+	assert.Equal(t, int64(len(b)), files[0].Size)
+	assert.Empty(t, files[0].tmpfile)
+
+	assert.Equal(t, "big.bin", files[1].Filename)
+	assert.Equal(t, int64(5000), files[1].Size)
+	assert.NotEmpty(t, files[1].tmpfile)
+	f, err = files[1].Open()
+	require.NoError(t, err)
+	b, err = io.ReadAll(f)
+	f.Close()
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("x", 5000), string(b))
+	require.NoError(t, r.MultipartForm.RemoveAll())
+	_, err = os.Stat(files[1].tmpfile)
+	assert.True(t, os.IsNotExist(err))
+
+	// Test: FormFile
+	r = newRequest()
+	file, fh, err := r.FormFile("upload")
+	require.NoError(t, err)
+	defer r.MultipartForm.RemoveAll()
+	assert.Equal(t, "report.csv", fh.Filename)
+	file.Close()
+
+	// Test: Too Many Parts
+	r = newRequest()
+	r.limits.MaxFormParts = 2
+	require.ErrorIs(t, r.ParseMultipartForm(1024), ErrBodyTooLarge)
+
+	// Test: Part Too Large
+	r = newRequest()
+	r.limits.MaxFormPartBytes = 100
+	require.ErrorIs(t, r.ParseMultipartForm(1024), ErrBodyTooLarge)
+
+	// Test: Missing Close-delimiter
+	reader := &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Content-Type: multipart/form-data; boundary=XyZ\r\n" +
+			"Content-Length: 52\r\n" +
+			"\r\n" +
+			"--XyZ\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\nb",
+		numBytesPerRead: 7,
+	}
+	r, err = NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	require.ErrorIs(t, r.ParseMultipartForm(1024), ErrMalformedForm)
+
+	// Test: Whitespace Before a Part's First Field Line
+	partBody := "--XyZ\r\n Content-Disposition: form-data; name=\"a\"\r\n\r\nb\r\n--XyZ--\r\n"
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Content-Type: multipart/form-data; boundary=XyZ\r\n" +
+			"Content-Length: " + strconv.Itoa(len(partBody)) + "\r\n" +
+			"\r\n" +
+			partBody,
+		numBytesPerRead: 7,
+	}
+	r, err = NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	err = r.ParseMultipartForm(1024)
+	require.ErrorIs(t, err, ErrMalformedForm)
+	require.ErrorIs(t, err, headers.ErrMalformedFieldLine)
+
+	// Test: Not Multipart
+	reader = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Content-Type: text/plain\r\n" +
+			"Content-Length: 1\r\n" +
+			"\r\n" +
+			"a",
+		numBytesPerRead: 7,
+	}
+	r, err = NewReader(reader).ReadRequest()
+	require.NoError(t, err)
+	require.ErrorIs(t, r.ParseMultipartForm(1024), ErrUnsupportedMediaType)
+}
+
+func TestCookies(t *testing.T) {
+	// Test: Cookie Pairs
+	reader := &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nCookie: session=abc123; theme=\"dark\";  empty=; lang=en-US\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	cookies := r.Cookies()
+	require.Len(t, cookies, 4)
+	assert.Equal(t, &Cookie{Name: "session", Value: "abc123"}, cookies[0])
+	assert.Equal(t, &Cookie{Name: "theme", Value: "dark"}, cookies[1])
+	assert.Equal(t, &Cookie{Name: "empty", Value: ""}, cookies[2])
+	c, err := r.Cookie("lang")
+	require.NoError(t, err)
+	assert.Equal(t, "en-US", c.Value)
+	_, err = r.Cookie("missing")
+	require.ErrorIs(t, err, ErrNoCookie)
+
+	// Test: Invalid Pairs Are Skipped
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nCookie: novalue; bad name=1; ok=1; quote=a\"b\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	cookies = r.Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "ok", cookies[0].Name)
+
+	// Test: No Cookie Header
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Empty(t, r.Cookies())
+}
+
+func headerValue(h *headers.Headers, key string) string {
+	v, _ := h.Get(key)
+	return v
+}
+
 type chunkReader struct {
 	data            string
 	numBytesPerRead int
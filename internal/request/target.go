@@ -0,0 +1,184 @@
+package request
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TargetForm is one of the four request-target forms of RFC 9112 §3.2.
+type TargetForm int
+
+const (
+	TargetFormOrigin    TargetForm = iota // /where?q=now
+	TargetFormAbsolute                    // http://www.example.org/pub/WWW/TheProject.html
+	TargetFormAuthority                   // www.example.com:80 (CONNECT only)
+	TargetFormAsterisk                    // * (server-wide OPTIONS only)
+)
+
+// Target is a parsed request-target.
+type Target struct {
+	Form TargetForm
+	// Scheme is only set for the absolute-form.
+	Scheme string
+	// Host is set for the absolute-form and the authority-form.
+	Host string
+	// Path is the percent-decoded path, RawPath is the path as it was sent.
+	Path     string
+	RawPath  string
+	RawQuery string
+	Query    Values
+}
+
+// Values maps a query or form key to its values in the order they were
+// sent.
+type Values map[string][]string
+
+// Get returns the first value for key, or "" if there is none.
+func (v Values) Get(key string) string {
+	vs := v[key]
+	if len(vs) == 0 {
+		return ""
+	}
+	return vs[0]
+}
+
+func parseTarget(method, raw string) (Target, error) {
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c <= ' ' || c == 0x7f || c == '#' {
+			return Target{}, fmt.Errorf("%w: invalid character in: %q", ErrInvalidTarget, raw)
+		}
+	}
+
+	switch {
+	case raw == "*":
+		if method != "OPTIONS" {
+			return Target{}, fmt.Errorf("%w: asterisk-form is only allowed for OPTIONS, got: %s", ErrInvalidTarget, method)
+		}
+		return Target{Form: TargetFormAsterisk, Path: "*", RawPath: "*", Query: Values{}}, nil
+	case method == "CONNECT":
+		host, port, ok := strings.Cut(raw, ":")
+		if !ok || host == "" || port == "" || strings.ContainsAny(raw, "/?@") {
+			return Target{}, fmt.Errorf("%w: CONNECT requires the authority-form, got: %s", ErrInvalidTarget, raw)
+		}
+		return Target{Form: TargetFormAuthority, Host: raw, Query: Values{}}, nil
+	case strings.HasPrefix(raw, "/"):
+		t := Target{Form: TargetFormOrigin}
+		return t, t.setPathAndQuery(raw)
+	}
+
+	scheme, rest, ok := strings.Cut(raw, "://")
+	if !ok || !validScheme(scheme) {
+		return Target{}, fmt.Errorf("%w: unrecognized form: %s", ErrInvalidTarget, raw)
+	}
+	t := Target{Form: TargetFormAbsolute, Scheme: strings.ToLower(scheme)}
+	idx := strings.IndexAny(rest, "/?")
+	if idx == -1 {
+		idx = len(rest)
+	}
+	t.Host = rest[:idx]
+	if t.Host == "" {
+		return Target{}, fmt.Errorf("%w: absolute-form without host: %s", ErrInvalidTarget, raw)
+	}
+	pathAndQuery := rest[idx:]
+	if !strings.HasPrefix(pathAndQuery, "/") {
+		pathAndQuery = "/" + pathAndQuery
+	}
+	return t, t.setPathAndQuery(pathAndQuery)
+}
+
+func (t *Target) setPathAndQuery(s string) error {
+	rawPath, rawQuery, _ := strings.Cut(s, "?")
+	path, err := unescape(rawPath, false)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidTarget, err)
+	}
+	query, err := parseQuery(rawQuery)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidTarget, err)
+	}
+	t.Path = path
+	t.RawPath = rawPath
+	t.RawQuery = rawQuery
+	t.Query = query
+	return nil
+}
+
+// parseQuery parses an application/x-www-form-urlencoded string such as a
+// query component.
+func parseQuery(s string) (Values, error) {
+	values := Values{}
+	for _, pair := range strings.Split(s, "&") {
+		if pair == "" {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		key, err := unescape(rawKey, true)
+		if err != nil {
+			return nil, err
+		}
+		value, err := unescape(rawValue, true)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = append(values[key], value)
+	}
+	return values, nil
+}
+
+// unescape decodes percent-encoded octets, and '+' as a space when plus is
+// set.
+func unescape(s string, plus bool) (string, error) {
+	if !strings.ContainsAny(s, "%+") {
+		return s, nil
+	}
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				return "", fmt.Errorf("invalid percent-encoding in: %s", s)
+			}
+			sb.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+		case c == '+' && plus:
+			sb.WriteByte(' ')
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), nil
+}
+
+func validScheme(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		isAlpha := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if i == 0 && !isAlpha {
+			return false
+		}
+		if !isAlpha && !(c >= '0' && c <= '9') && c != '+' && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
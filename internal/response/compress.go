@@ -0,0 +1,162 @@
+package response
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/iferdel-vault/tcptohttp/internal/headers"
+)
+
+// compressMinSize is the smallest body worth compressing; below it the
+// framing of the compressed format eats most of the gain.
+const compressMinSize = 1 << 10
+
+// encoder is what gzip.Writer and zlib.Writer have in common.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	"gzip": {New: func() any { return gzip.NewWriter(nil) }},
+	// the "deflate" content coding is the zlib format (RFC 9110 §8.4.1.2)
+	"deflate": {New: func() any { return zlib.NewWriter(nil) }},
+}
+
+// SetCompression makes the writer compress the response body with coding,
+// "gzip" or "deflate", when the body is large enough and of a compressible
+// type and the handler has not set a Content-Encoding itself. An empty
+// coding means the client accepts none, so nothing is compressed. Either way
+// Vary: Accept-Encoding is added, since the choice depended on it.
+func (w *Writer) SetCompression(coding string) error {
+	if coding != "" && encoderPools[coding] == nil {
+		return fmt.Errorf("unsupported content coding: %q", coding)
+	}
+	if w.wroteHeaders {
+		return fmt.Errorf("cannot set compression after headers are written")
+	}
+	w.negotiated = true
+	w.coding = coding
+	return nil
+}
+
+// prepareEncoding adds Vary to h and reports whether a body of length
+// bytes, or of unknown length if length is negative, should be compressed.
+// If so it also sets Content-Encoding and turns a strong ETag weak, since the
+// compressed bytes are not those the tag was made for.
+func (w *Writer) prepareEncoding(h *headers.Headers, length int64) bool {
+	if !w.negotiated {
+		return false
+	}
+	if !h.HasToken("Vary", "Accept-Encoding") && !h.HasToken("Vary", "*") {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if w.coding == "" || !shouldCompress(h, w.status) || (length >= 0 && length < compressMinSize) {
+		return false
+	}
+	h.Set("Content-Encoding", w.coding)
+	h.Del("Content-Length")
+	if etag, ok := h.Get("ETag"); ok && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+	return true
+}
+
+// shouldCompress reports whether a response with h and statusCode has a
+// body that compressing would help.
+func shouldCompress(h *headers.Headers, statusCode StatusCode) bool {
+	if !bodyAllowed(statusCode) || statusCode == StatusPartialContent {
+		// a range is of the uncompressed content
+		return false
+	}
+	if _, ok := h.Get("Content-Encoding"); ok {
+		return false
+	}
+	if _, ok := h.Get("Content-Range"); ok {
+		return false
+	}
+	if h.HasToken("Cache-Control", "no-transform") {
+		return false
+	}
+	ctype, ok := h.Get("Content-Type")
+	if !ok {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(ctype)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml",
+		"application/wasm", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// compressBuffered compresses the body held by Write into a new buffer,
+// so that it can still be sent with a Content-Length.
+func (w *Writer) compressBuffered(h *headers.Headers) error {
+	if !w.prepareEncoding(h, int64(len(w.buf))) {
+		return nil
+	}
+	var compressed bytes.Buffer
+	enc := encoderPools[w.coding].Get().(encoder)
+	enc.Reset(&compressed)
+	_, err := enc.Write(w.buf)
+	if err == nil {
+		err = enc.Close()
+	}
+	encoderPools[w.coding].Put(enc)
+	if err != nil {
+		return err
+	}
+	w.buf = compressed.Bytes()
+	h.Set("Content-Length", strconv.Itoa(len(w.buf)))
+	return nil
+}
+
+func (w *Writer) startEncoder() {
+	enc := encoderPools[w.coding].Get().(encoder)
+	enc.Reset(encodedBody{w})
+	w.encoder = enc
+}
+
+// closeEncoder writes the end of the compressed stream.
+func (w *Writer) closeEncoder() error {
+	if w.encoder == nil {
+		return nil
+	}
+	err := w.encoder.Close()
+	w.encoder.Reset(nil)
+	encoderPools[w.coding].Put(w.encoder)
+	w.encoder = nil
+	return err
+}
+
+// encodedBody receives the output of the encoder and sends it as the body.
+type encodedBody struct {
+	w *Writer
+}
+
+func (e encodedBody) Write(p []byte) (int, error) {
+	_, err := e.w.writeChunk(p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,121 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iferdel-vault/tcptohttp/internal/headers"
+)
+
+// TimeFormat is the IMF-fixdate format used in HTTP dates.
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+type SameSite int
+
+const (
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+// Cookie is written as a Set-Cookie header, see RFC 6265 §4.1.
+type Cookie struct {
+	Name  string
+	Value string
+
+	Path    string
+	Domain  string
+	Expires time.Time
+	// MaxAge > 0 sets Max-Age in seconds, MaxAge < 0 asks the client to
+	// delete the cookie right away and 0 leaves Max-Age out.
+	MaxAge      int
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+// Valid reports whether the cookie can be serialized and would be accepted
+// by browsers.
+func (c *Cookie) Valid() error {
+	if !headers.IsToken(c.Name) {
+		return fmt.Errorf("invalid cookie name: %q", c.Name)
+	}
+	for i := 0; i < len(c.Value); i++ {
+		if !validCookieValueByte(c.Value[i]) {
+			return fmt.Errorf("invalid byte %q in cookie value", c.Value[i])
+		}
+	}
+	for _, attr := range []string{c.Path, c.Domain} {
+		for i := 0; i < len(attr); i++ {
+			if attr[i] < 0x20 || attr[i] == 0x7f || attr[i] == ';' {
+				return fmt.Errorf("invalid byte %q in cookie attribute %q", attr[i], attr)
+			}
+		}
+	}
+	if !c.Expires.IsZero() && c.Expires.Year() < 1601 {
+		return fmt.Errorf("invalid cookie Expires: %v", c.Expires)
+	}
+	if c.SameSite == SameSiteNone && !c.Secure {
+		return errors.New("cookie with SameSite=None must be Secure")
+	}
+	if c.Partitioned && !c.Secure {
+		return errors.New("partitioned cookie must be Secure")
+	}
+	return nil
+}
+
+// String serializes the cookie as a Set-Cookie field value. A value with
+// spaces or commas is quoted.
+func (c *Cookie) String() string {
+	var sb strings.Builder
+	sb.WriteString(c.Name)
+	sb.WriteByte('=')
+	if strings.ContainsAny(c.Value, " ,") {
+		sb.WriteString(`"` + c.Value + `"`)
+	} else {
+		sb.WriteString(c.Value)
+	}
+	if c.Path != "" {
+		sb.WriteString("; Path=" + c.Path)
+	}
+	if c.Domain != "" {
+		sb.WriteString("; Domain=" + strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() {
+		sb.WriteString("; Expires=" + c.Expires.UTC().Format(TimeFormat))
+	}
+	if c.MaxAge > 0 {
+		sb.WriteString("; Max-Age=" + strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		sb.WriteString("; Max-Age=0")
+	}
+	if c.HttpOnly {
+		sb.WriteString("; HttpOnly")
+	}
+	if c.Secure {
+		sb.WriteString("; Secure")
+	}
+	switch c.SameSite {
+	case SameSiteLax:
+		sb.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		sb.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		sb.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		sb.WriteString("; Partitioned")
+	}
+	return sb.String()
+}
+
+// validCookieValueByte accepts cookie-octets, plus spaces and commas which
+// String quotes.
+func validCookieValueByte(c byte) bool {
+	return c >= 0x20 && c < 0x7f && c != '"' && c != ';' && c != '\\'
+}
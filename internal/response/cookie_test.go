@@ -0,0 +1,72 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iferdel-vault/tcptohttp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCookieString(t *testing.T) {
+	// Test: Name and Value Only
+	c := &Cookie{Name: "session", Value: "abc123"}
+	require.NoError(t, c.Valid())
+	assert.Equal(t, "session=abc123", c.String())
+
+	// Test: All Attributes
+	c = &Cookie{
+		Name:        "id",
+		Value:       "a3fWa",
+		Path:        "/docs",
+		Domain:      ".example.com",
+		Expires:     time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC),
+		MaxAge:      3600,
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteNone,
+		Partitioned: true,
+	}
+	require.NoError(t, c.Valid())
+	assert.Equal(t, "id=a3fWa; Path=/docs; Domain=example.com; Expires=Wed, 21 Oct 2015 07:28:00 GMT; Max-Age=3600; HttpOnly; Secure; SameSite=None; Partitioned", c.String())
+
+	// Test: Delete Cookie
+	c = &Cookie{Name: "id", MaxAge: -1, SameSite: SameSiteStrict}
+	assert.Equal(t, "id=; Max-Age=0; SameSite=Strict", c.String())
+
+	// Test: Value With Space Is Quoted
+	c = &Cookie{Name: "greeting", Value: "hello world", SameSite: SameSiteLax}
+	require.NoError(t, c.Valid())
+	assert.Equal(t, `greeting="hello world"; SameSite=Lax`, c.String())
+
+	// Test: Invalid Cookies
+	assert.Error(t, (&Cookie{Name: "bad name", Value: "x"}).Valid())
+	assert.Error(t, (&Cookie{Name: "n", Value: "a;b"}).Valid())
+	assert.Error(t, (&Cookie{Name: "n", Value: "a\r\nX-Injected: 1"}).Valid())
+	assert.Error(t, (&Cookie{Name: "n", Path: "/;Domain=evil"}).Valid())
+	assert.Error(t, (&Cookie{Name: "n", SameSite: SameSiteNone}).Valid())
+	assert.Error(t, (&Cookie{Name: "n", Partitioned: true}).Valid())
+}
+
+func TestWriterSetCookie(t *testing.T) {
+	// Test: Each Cookie on Its Own Line
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.SetCookie(&Cookie{Name: "a", Value: "1"}))
+	require.NoError(t, w.SetCookie(&Cookie{Name: "b", Value: "2", HttpOnly: true}))
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	require.NoError(t, w.Flush())
+	assert.Contains(t, buf.String(), "Set-Cookie: a=1\r\n")
+	assert.Contains(t, buf.String(), "Set-Cookie: b=2; HttpOnly\r\n")
+	assert.Equal(t, 2, strings.Count(buf.String(), "Set-Cookie:"))
+
+	// Test: Invalid Cookie Is Refused
+	require.Error(t, NewWriter(&buf).SetCookie(&Cookie{Name: "a b"}))
+
+	// Test: Cookie After Headers Is Refused
+	require.Error(t, w.SetCookie(&Cookie{Name: "c", Value: "3"}))
+}
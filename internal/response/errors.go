@@ -0,0 +1,12 @@
+package response
+
+import "errors"
+
+var (
+	// ErrBodyTooLong is returned by writes that would go past the declared
+	// Content-Length. Nothing of the write is sent.
+	ErrBodyTooLong = errors.New("response body longer than Content-Length")
+	// ErrBodyTooShort is returned by Finish when fewer bytes were written
+	// than the declared Content-Length. The connection cannot be reused.
+	ErrBodyTooShort = errors.New("response body shorter than Content-Length")
+)
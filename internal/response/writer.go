@@ -1,8 +1,15 @@
 package response
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/iferdel-vault/tcptohttp/internal/headers"
 )
@@ -17,50 +24,267 @@ const (
 )
 
 type Writer struct {
-	writerState writerState
-	conn        io.Writer
+	writerState  writerState
+	conn         io.Writer
+	httpVersion  string
+	keepAlive    bool
+	wroteHeaders bool
+	// unchunked is set when a chunked response goes to an HTTP/1.0 client,
+	// which gets the raw body delimited by closing the connection instead.
+	unchunked bool
+	// informational is set while a 1xx response is being written; it is
+	// followed by another status line instead of a body.
+	informational bool
+	// awaitingContinue is set while the client holds back the body until
+	// it gets a 100 (Continue).
+	awaitingContinue bool
+	// keepAliveCheck, if set, is asked just before the final headers are
+	// written whether the connection can be reused after the response.
+	keepAliveCheck func() bool
+	// head is set when answering a HEAD request: the headers are written as
+	// for GET but body writes are dropped.
+	head bool
+	// canonicalNames writes field names as "Content-Type" regardless of
+	// how they were set.
+	canonicalNames bool
+	cookies        []*Cookie
+	// chunked is set once headers announcing a chunked body are written.
+	chunked bool
+	// negotiated is set by SetCompression; coding is the content coding to
+	// use, if any, and encoder compresses the body once it is chosen.
+	negotiated bool
+	coding     string
+	encoder    encoder
+	// contentLength is the declared body length, or -1 if there is none;
+	// written counts the body bytes sent against it.
+	contentLength int64
+	written       int64
+
+	// header, status and buf back the io.Writer API: nothing is sent until
+	// the body outgrows buf or Finish is called.
+	header *headers.Headers
+	status StatusCode
+	buf    []byte
+
+	// out holds the status line, headers and small writes until Flush.
+	out     *bytes.Buffer
+	bufs    net.Buffers
+	vec     [4][]byte
+	scratch [20]byte
+}
+
+// bufferSize is how much of a body Write holds back to send it with a
+// Content-Length instead of chunked, and how much output is held back
+// before it goes to the connection.
+const bufferSize = 4 << 10
+
+var (
+	crlf      = []byte("\r\n")
+	lastChunk = []byte("0\r\n")
+)
+
+var bufPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
 }
 
+// NewWriter returns a Writer for one response on w. Output is buffered:
+// it reaches w on Flush, on Finish, or when the buffer fills up.
 func NewWriter(w io.Writer) *Writer {
 	return &Writer{
-		writerState: WriterStateStatusLine,
-		conn:        w,
+		writerState:   WriterStateStatusLine,
+		conn:          w,
+		httpVersion:   "1.1",
+		keepAlive:     true,
+		contentLength: -1,
+	}
+}
+
+// SetHttpVersion sets the version echoed in the status line. Only "1.0"
+// and "1.1" are meaningful; an HTTP/1.0 response is never chunked.
+func (w *Writer) SetHttpVersion(version string) {
+	w.httpVersion = version
+}
+
+// SetKeepAlive sets whether the connection may be reused after this
+// response. When it may not, WriteHeaders adds "Connection: close".
+func (w *Writer) SetKeepAlive(keepAlive bool) {
+	w.keepAlive = keepAlive
+}
+
+// SetKeepAliveCheck sets a function that decides, just before the final
+// headers are written, whether the connection can carry another request.
+// If it returns false the response gets "Connection: close".
+func (w *Writer) SetKeepAliveCheck(check func() bool) {
+	w.keepAliveCheck = check
+}
+
+// KeepAlive reports whether a complete response was written and the
+// connection can carry another one.
+func (w *Writer) KeepAlive() bool {
+	return w.keepAlive && w.wroteHeaders && w.writerState == WriterStateStatusLine
+}
+
+// SetHead marks the response as the answer to a HEAD request. Handlers
+// write it as they would for GET, Content-Length included, and the writer
+// drops the body.
+func (w *Writer) SetHead(head bool) {
+	w.head = head
+}
+
+// SetCanonicalHeaderNames sets whether header and trailer names are
+// written in canonical form (see headers.CanonicalName) instead of the
+// casing they were set with.
+func (w *Writer) SetCanonicalHeaderNames(canonical bool) {
+	w.canonicalNames = canonical
+}
+
+// SetCookie queues c to be written as its own Set-Cookie line by the next
+// WriteHeaders.
+func (w *Writer) SetCookie(c *Cookie) error {
+	if w.wroteHeaders {
+		return errors.New("cannot set cookie after headers are written")
+	}
+	err := c.Valid()
+	if err != nil {
+		return err
 	}
+	w.cookies = append(w.cookies, c)
+	return nil
 }
 
+// WriteStatusLine writes the status line with the registered reason phrase
+// for statusCode, or an empty one if the code is not registered.
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineReason(statusCode, StatusCodeReasonPhrase[statusCode])
+}
+
+// WriteStatusLineReason writes the status line with a custom reason
+// phrase. It refuses codes outside 100-999 and phrases with control
+// characters.
+func (w *Writer) WriteStatusLineReason(statusCode StatusCode, reasonPhrase string) error {
 	if w.writerState != WriterStateStatusLine {
 		return fmt.Errorf("cannot write status line in state %d", w.writerState)
 	}
+	err := checkStatusLine(statusCode, reasonPhrase)
+	if err != nil {
+		return err
+	}
 	defer func() { w.writerState = WriterStateHeaders }()
 
-	_, err := w.conn.Write(getStatusLine(statusCode))
-	return err
+	w.informational = statusCode >= 100 && statusCode < 200
+	if !w.informational {
+		w.status = statusCode
+	}
+	out := w.buffer()
+	out.Write(appendStatusLine(out.AvailableBuffer(), w.httpVersion, statusCode, reasonPhrase))
+	return nil
+}
+
+// ExpectContinue tells the writer that the client waits for a 100
+// (Continue) before sending the body. A final response written before
+// WriteContinue closes the connection, since the body may never arrive.
+func (w *Writer) ExpectContinue() {
+	w.awaitingContinue = true
+}
+
+// WriteContinue sends an interim 100 (Continue) response. It does nothing
+// once the final response has been started.
+func (w *Writer) WriteContinue() error {
+	if w.writerState != WriterStateStatusLine || w.wroteHeaders {
+		return nil
+	}
+	w.awaitingContinue = false
+	err := w.WriteStatusLine(StatusContinue)
+	if err != nil {
+		return err
+	}
+	return w.WriteHeaders(headers.NewHeaders())
 }
 
-func (w *Writer) WriteHeaders(headers headers.Headers) error {
+func (w *Writer) WriteHeaders(headers *headers.Headers) error {
 	if w.writerState != WriterStateHeaders {
 		return fmt.Errorf("cannot write headers in state %d", w.writerState)
 	}
-	defer func() { w.writerState = WriterStateBody }()
-
-	for key, value := range headers {
-		_, err := w.conn.Write([]byte(fmt.Sprintf("%s: %s\r\n", key, value)))
+	if w.informational {
+		w.informational = false
+		w.writerState = WriterStateStatusLine
+		err := w.writeFields(headers)
 		if err != nil {
 			return err
 		}
+		// the client is waiting for it
+		return w.Flush()
 	}
-	_, err := w.conn.Write([]byte("\r\n"))
-	return err
+	declared := int64(-1)
+	if length, ok := headers.Get("Content-Length"); ok {
+		declared, _ = strconv.ParseInt(length, 10, 64)
+	}
+	encode := w.prepareEncoding(headers, declared)
+	if encode && !headers.HasToken("Transfer-Encoding", "chunked") {
+		// the compressed length is not known up front
+		headers.Set("Transfer-Encoding", "chunked")
+	}
+	length, hasLength := headers.Get("Content-Length")
+	chunked := headers.HasToken("Transfer-Encoding", "chunked")
+	if hasLength && !chunked && bodyAllowed(w.status) {
+		n, err := strconv.ParseInt(length, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid Content-Length: %q", length)
+		}
+		w.contentLength = n
+	}
+	defer func() { w.writerState = WriterStateBody }()
+
+	if headers.HasToken("Connection", "close") || w.awaitingContinue {
+		w.keepAlive = false
+	}
+	if w.keepAlive && w.keepAliveCheck != nil && !w.keepAliveCheck() {
+		w.keepAlive = false
+	}
+	w.chunked = chunked
+	if encode && !w.head {
+		w.startEncoder()
+	}
+	if chunked && w.httpVersion == "1.0" {
+		headers.Del("Transfer-Encoding")
+		headers.Del("Trailer")
+		w.unchunked = true
+		chunked = false
+	}
+	if !hasLength && !chunked && bodyAllowed(w.status) && !w.head {
+		// the body is delimited by closing the connection
+		w.keepAlive = false
+	}
+	if !w.keepAlive {
+		headers.Set("Connection", "close")
+	} else if w.httpVersion == "1.0" {
+		headers.Set("Connection", "keep-alive")
+	}
+	w.wroteHeaders = true
+
+	return w.writeFields(headers)
 }
 
+// WriteBody writes p as part of a body framed by Content-Length or by
+// closing the connection. It can be called any number of times; Finish ends
+// the response. A write that would go past the Content-Length fails with
+// ErrBodyTooLong.
 func (w *Writer) WriteBody(p []byte) (int, error) {
 	if w.writerState != WriterStateBody {
 		return 0, fmt.Errorf("cannot write body in state %d", w.writerState)
 	}
-	defer func() { w.writerState = WriterStateStatusLine }()
-
-	n, err := w.conn.Write(p)
+	if w.contentLength >= 0 && w.written+int64(len(p)) > w.contentLength {
+		return 0, fmt.Errorf("%w: %d more bytes after %d of %d", ErrBodyTooLong, len(p), w.written, w.contentLength)
+	}
+	if w.head {
+		w.written += int64(len(p))
+		return len(p), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	n, err := w.writeData(nil, p, nil)
+	w.written += int64(n)
 	return n, err
 }
 
@@ -68,28 +292,25 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	if w.writerState != WriterStateBody {
 		return 0, fmt.Errorf("cannot write body in state %d", w.writerState)
 	}
-	chunkSize := len(p)
-
-	nTotal := 0
-	n, err := fmt.Fprintf(w.conn, "%x\r\n", chunkSize)
-	if err != nil {
-		return nTotal, nil
+	if w.head {
+		return len(p), nil
 	}
-	nTotal += n
-
-	n, err = w.conn.Write(p)
-	if err != nil {
-		return nTotal, err
+	if w.encoder != nil {
+		return w.encoder.Write(p)
 	}
-	nTotal += n
+	return w.writeChunk(p)
+}
 
-	n, err = w.conn.Write([]byte("\r\n"))
-	if err != nil {
-		return nTotal, err
+func (w *Writer) writeChunk(p []byte) (int, error) {
+	if w.unchunked {
+		return w.writeData(nil, p, nil)
 	}
-	nTotal += n
-
-	return nTotal, nil
+	if len(p) == 0 {
+		return 0, nil
+	}
+	sizeLine := strconv.AppendInt(w.scratch[:0], int64(len(p)), 16)
+	sizeLine = append(sizeLine, "\r\n"...)
+	return w.writeData(sizeLine, p, crlf)
 }
 
 func (w *Writer) WriteChunkedBodyDone() (int, error) {
@@ -98,25 +319,386 @@ func (w *Writer) WriteChunkedBodyDone() (int, error) {
 	}
 	defer func() { w.writerState = WriterStateTrailers }()
 
-	n, err := w.conn.Write([]byte("0\r\n"))
+	err := w.closeEncoder()
 	if err != nil {
-		return n, err
+		return 0, err
 	}
-	return n, nil
+	if w.unchunked || w.head {
+		return 0, nil
+	}
+	return w.writeData(nil, lastChunk, nil)
 }
 
-func (w *Writer) WriteTrailers(h headers.Headers) error {
+func (w *Writer) WriteTrailers(h *headers.Headers) error {
 	if w.writerState != WriterStateTrailers {
 		return fmt.Errorf("cannot write trailers in state %d", w.writerState)
 	}
 	defer func() { w.writerState = WriterStateStatusLine }()
 
-	for key, value := range h {
-		_, err := w.conn.Write([]byte(fmt.Sprintf("%s: %s\r\n", key, value)))
+	if w.unchunked || w.head {
+		// trailers have no place in a close-delimited or missing body
+		return nil
+	}
+	return w.writeFields(h)
+}
+
+// writeFields writes a header or trailer section followed by the empty line
+// that ends it. The framing fields go first, then the rest in the order
+// they were added, then any cookies queued by SetCookie. Nothing is written
+// if a field would not be a valid field line.
+func (w *Writer) writeFields(h *headers.Headers) error {
+	buf := w.buffer()
+	start := buf.Len()
+	for _, name := range framingFields {
+		for key, value := range h.All() {
+			if strings.EqualFold(key, name) {
+				w.appendField(buf, key, value)
+			}
+		}
+	}
+	for key, value := range h.All() {
+		err := headers.CheckField(key, value)
 		if err != nil {
+			buf.Truncate(start)
 			return err
 		}
+		if isFramingField(key) {
+			continue
+		}
+		w.appendField(buf, key, value)
+	}
+	if w.writerState == WriterStateHeaders && !w.informational {
+		for _, c := range w.cookies {
+			w.appendField(buf, "Set-Cookie", c.String())
+		}
+	}
+	buf.WriteString("\r\n")
+	if buf.Len() > bufferSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+func (w *Writer) appendField(buf *bytes.Buffer, key, value string) {
+	if w.canonicalNames {
+		key = headers.CanonicalName(key)
+	}
+	buf.WriteString(key)
+	buf.WriteString(": ")
+	buf.WriteString(value)
+	buf.WriteString("\r\n")
+}
+
+// framingFields are written ahead of every other field, in this order.
+var framingFields = []string{"Content-Length", "Transfer-Encoding"}
+
+func isFramingField(key string) bool {
+	for _, f := range framingFields {
+		if strings.EqualFold(key, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// Header returns the fields sent with the response by the first Write that
+// does not fit in the buffer, or by Finish.
+func (w *Writer) Header() *headers.Headers {
+	if w.header == nil {
+		w.header = headers.NewHeaders()
+	}
+	return w.header
+}
+
+// WriteHeader sets the status code sent with Header. Without it the
+// response is 200 (OK).
+func (w *Writer) WriteHeader(statusCode StatusCode) error {
+	if w.wroteHeaders || w.writerState != WriterStateStatusLine {
+		return errors.New("cannot set status after headers are written")
+	}
+	err := checkStatusLine(statusCode, "")
+	if err != nil {
+		return err
 	}
-	_, err := w.conn.Write([]byte("\r\n"))
+	w.status = statusCode
+	return nil
+}
+
+// ErrBodyNotAllowed is returned by Write when the response status does not
+// allow a body.
+var ErrBodyNotAllowed = errors.New("response status does not allow a body")
+
+// Write adds p to the body. Small bodies are buffered and sent by Finish
+// with a Content-Length; once the buffer is outgrown the status line and
+// headers are sent and the body is streamed chunked, unless Header already
+// sets the framing.
+func (w *Writer) Write(p []byte) (int, error) {
+	if !bodyAllowed(w.pendingStatus()) {
+		return 0, ErrBodyNotAllowed
+	}
+	if w.writerState == WriterStateStatusLine && !w.wroteHeaders {
+		if len(w.buf)+len(p) <= bufferSize {
+			w.buf = append(w.buf, p...)
+			return len(p), nil
+		}
+		h := w.Header()
+		if !hasFraming(h) {
+			h.Set("Transfer-Encoding", "chunked")
+		}
+		err := w.writeHeader(h)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if w.writerState != WriterStateBody {
+		return 0, fmt.Errorf("cannot write body in state %d", w.writerState)
+	}
+	if len(w.buf) > 0 {
+		buffered := w.buf
+		w.buf = nil
+		_, err := w.writeBody(buffered)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return w.writeBody(p)
+}
+
+// Finish completes the response, whichever API it was written with: it
+// sends a status line and headers if they are still pending, whatever is
+// buffered, and the end of a chunked body. It only flushes if the response
+// is already complete. If the body is shorter than its Content-Length it
+// returns ErrBodyTooShort and the connection must not be reused.
+func (w *Writer) Finish() error {
+	err := w.finish()
+	if err != nil && !errors.Is(err, ErrBodyTooShort) {
+		return err
+	}
+	flushErr := w.Flush()
+	putBuffer(w.out)
+	w.out = nil
+	if err != nil {
+		return err
+	}
+	return flushErr
+}
+
+// Flush writes any buffered output to the connection, including what a
+// compressor holds back.
+func (w *Writer) Flush() error {
+	if w.encoder != nil {
+		err := w.encoder.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	if w.out == nil || w.out.Len() == 0 {
+		return nil
+	}
+	_, err := w.conn.Write(w.out.Bytes())
+	w.out.Reset()
 	return err
 }
+
+func (w *Writer) finish() error {
+	if !bodyAllowed(w.pendingStatus()) {
+		// written before WriteHeader set a status without a body
+		w.buf = nil
+	}
+	if w.writerState == WriterStateStatusLine {
+		if w.wroteHeaders {
+			return nil
+		}
+		err := w.WriteStatusLine(w.pendingStatus())
+		if err != nil {
+			return err
+		}
+	}
+	if w.writerState == WriterStateHeaders {
+		h := w.Header()
+		if !hasFraming(h) && bodyAllowed(w.status) {
+			h.Set("Content-Length", strconv.Itoa(len(w.buf)))
+			err := w.compressBuffered(h)
+			if err != nil {
+				return err
+			}
+		}
+		err := w.WriteHeaders(h)
+		if err != nil {
+			return err
+		}
+	}
+	if w.writerState == WriterStateBody {
+		if len(w.buf) > 0 {
+			buffered := w.buf
+			w.buf = nil
+			_, err := w.writeBody(buffered)
+			if err != nil {
+				return err
+			}
+		}
+		if !w.chunked {
+			w.writerState = WriterStateStatusLine
+			if w.contentLength >= 0 && w.written < w.contentLength && !w.head {
+				w.keepAlive = false
+				return fmt.Errorf("%w: %d of %d bytes written", ErrBodyTooShort, w.written, w.contentLength)
+			}
+			return nil
+		}
+		_, err := w.WriteChunkedBodyDone()
+		if err != nil {
+			return err
+		}
+	}
+	if w.writerState == WriterStateTrailers {
+		return w.WriteTrailers(headers.NewHeaders())
+	}
+	return nil
+}
+
+func (w *Writer) pendingStatus() StatusCode {
+	if w.status == 0 {
+		return StatusOK
+	}
+	return w.status
+}
+
+func (w *Writer) writeHeader(h *headers.Headers) error {
+	err := w.WriteStatusLine(w.pendingStatus())
+	if err != nil {
+		return err
+	}
+	return w.WriteHeaders(h)
+}
+
+func (w *Writer) writeBody(p []byte) (int, error) {
+	if !w.chunked {
+		return w.WriteBody(p)
+	}
+	if len(p) == 0 {
+		// an empty chunk would end the body
+		return 0, nil
+	}
+	// io.Writer counts only p, not the chunk framing around it
+	_, err := w.WriteChunkedBody(p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func hasFraming(h *headers.Headers) bool {
+	_, hasLength := h.Get("Content-Length")
+	_, hasEncoding := h.Get("Transfer-Encoding")
+	return hasLength || hasEncoding
+}
+
+// bodyAllowed reports whether a response with statusCode can have a body
+// (RFC 9110 §6.4.1).
+func bodyAllowed(statusCode StatusCode) bool {
+	return statusCode >= 200 && statusCode != StatusNoContent && statusCode != StatusNotModified
+}
+
+func (w *Writer) buffer() *bytes.Buffer {
+	if w.out == nil {
+		w.out = bufPool.Get().(*bytes.Buffer)
+	}
+	return w.out
+}
+
+func putBuffer(b *bytes.Buffer) {
+	// don't keep the memory of an unusually large response around
+	if b == nil || b.Cap() > 4*bufferSize {
+		return
+	}
+	b.Reset()
+	bufPool.Put(b)
+}
+
+// writeData writes prefix, p and suffix after any buffered output. Small
+// writes are added to the buffer; anything larger goes out together with
+// the buffer in a single writev where the connection supports it. The
+// returned count excludes previously buffered output.
+func (w *Writer) writeData(prefix, p, suffix []byte) (int, error) {
+	out := w.buffer()
+	size := len(prefix) + len(p) + len(suffix)
+	if out.Len()+size <= bufferSize {
+		out.Write(prefix)
+		out.Write(p)
+		out.Write(suffix)
+		return size, nil
+	}
+	buffered := out.Len()
+	w.bufs = w.vec[:0]
+	for _, b := range [][]byte{out.Bytes(), prefix, p, suffix} {
+		if len(b) > 0 {
+			w.bufs = append(w.bufs, b)
+		}
+	}
+	n, err := w.bufs.WriteTo(w.conn)
+	w.vec = [4][]byte{}
+	out.Reset()
+	return max(int(n)-buffered, 0), err
+}
+
+// ReadFrom implements io.ReaderFrom, so io.Copy into the writer takes this
+// path. Once the headers are written, a body that is neither chunked nor
+// compressed goes straight to the connection: when that is a *net.TCPConn
+// and src is an *os.File, possibly behind an *io.LimitedReader, the kernel
+// copies it with sendfile or splice. Anything else falls back to Write.
+func (w *Writer) ReadFrom(src io.Reader) (int64, error) {
+	if w.writerState == WriterStateStatusLine && !w.wroteHeaders && len(w.buf) == 0 && hasFraming(w.Header()) {
+		// the framing is set, so there is nothing to gain from buffering
+		err := w.writeHeader(w.Header())
+		if err != nil {
+			return 0, err
+		}
+	}
+	conn, ok := w.conn.(*net.TCPConn)
+	if !ok || w.writerState != WriterStateBody || w.encoder != nil || w.head || (w.chunked && !w.unchunked) {
+		return io.Copy(writerOnly{w}, src)
+	}
+
+	limited, isLimited := src.(*io.LimitedReader)
+	if w.contentLength >= 0 {
+		remaining := w.contentLength - w.written
+		if isLimited && limited.N > remaining {
+			// let WriteBody refuse what does not fit
+			return io.Copy(writerOnly{w}, src)
+		}
+		if !isLimited {
+			limited = &io.LimitedReader{R: src, N: remaining}
+			src = limited
+		}
+	}
+	err := w.Flush()
+	if err != nil {
+		return 0, err
+	}
+	n, err := conn.ReadFrom(src)
+	w.written += n
+	if err != nil || w.contentLength < 0 || isLimited || limited.N > 0 {
+		return n, err
+	}
+	var probe [1]byte
+	m, _ := limited.R.Read(probe[:])
+	if m > 0 {
+		return n, fmt.Errorf("%w: more bytes after %d", ErrBodyTooLong, w.contentLength)
+	}
+	return n, nil
+}
+
+// WriteFile writes length bytes of f, starting at offset, as the body, with
+// sendfile where ReadFrom can use it.
+func (w *Writer) WriteFile(f *os.File, offset, length int64) (int64, error) {
+	_, err := f.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	return w.ReadFrom(io.LimitReader(f, length))
+}
+
+// writerOnly hides ReadFrom from io.Copy so that it uses Write.
+type writerOnly struct {
+	io.Writer
+}
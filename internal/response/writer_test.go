@@ -0,0 +1,837 @@
+package response
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
+	"net/http/httputil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/iferdel-vault/tcptohttp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteHeaders(t *testing.T) {
+	// Test: Repeated fields are written as separate lines in order
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	h := headers.NewHeaders()
+	h.Add("Content-Length", "0")
+	h.Add("WWW-Authenticate", `Basic realm="site"`)
+	h.Add("Set-Cookie", "a=1")
+	h.Add("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+	h.Add("Set-Cookie", "b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 0\r\n"+
+		"WWW-Authenticate: Basic realm=\"site\"\r\n"+
+		"Set-Cookie: a=1\r\n"+
+		"WWW-Authenticate: Bearer realm=\"api\", error=\"invalid_token\"\r\n"+
+		"Set-Cookie: b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT\r\n"+
+		"\r\n", buf.String())
+
+	// Test: Trailers are written in order
+	buf.Reset()
+	w = NewWriter(&buf)
+	h = headers.NewHeaders()
+	h.Add("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	require.NoError(t, w.Flush())
+	_, err := w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	th := headers.NewHeaders()
+	th.Add("X-Checksum", "1")
+	th.Add("X-Checksum", "2")
+	require.NoError(t, w.WriteTrailers(th))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"0\r\n"+
+		"X-Checksum: 1\r\n"+
+		"X-Checksum: 2\r\n"+
+		"\r\n", buf.String())
+}
+
+func TestWriteHeadersOrder(t *testing.T) {
+	// Test: Framing fields first, then insertion order, then cookies
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.SetCookie(&Cookie{Name: "id", Value: "7"}))
+	h := headers.NewHeaders()
+	h.Add("content-type", "text/plain")
+	h.Add("X-B", "2")
+	h.Add("content-length", "5")
+	h.Add("X-A", "1")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"content-length: 5\r\n"+
+		"content-type: text/plain\r\n"+
+		"X-B: 2\r\n"+
+		"X-A: 1\r\n"+
+		"Set-Cookie: id=7\r\n"+
+		"\r\n", buf.String())
+
+	// Test: Output is the same on every run
+	for range 20 {
+		var again bytes.Buffer
+		w := NewWriter(&again)
+		w.SetCookie(&Cookie{Name: "id", Value: "7"})
+		w.WriteStatusLine(StatusOK)
+		w.WriteHeaders(h)
+		w.Flush()
+		require.Equal(t, buf.String(), again.String())
+	}
+
+	// Test: Canonical names
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetCanonicalHeaderNames(true)
+	h = headers.NewHeaders()
+	h.Add("x-request-id", "abc")
+	h.Add("CONTENT-LENGTH", "0")
+	h.Add("connection", "close")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 0\r\n"+
+		"X-Request-Id: abc\r\n"+
+		"Connection: close\r\n"+
+		"\r\n", buf.String())
+}
+
+func TestWriteHeadersInjection(t *testing.T) {
+	// Test: Injected value never reaches the connection
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	h := headers.NewHeaders()
+	require.Error(t, h.Set("Location", "/a\r\nSet-Cookie: evil=1"))
+	h.Set("Content-Length", "0")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(h))
+	require.NoError(t, w.Flush())
+	assert.NotContains(t, buf.String(), "evil")
+}
+
+func TestWriteStatusLine(t *testing.T) {
+	// Test: Registered code
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(StatusNotFound))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\n", buf.String())
+
+	// Test: Every registered code has a phrase
+	for code, phrase := range StatusCodeReasonPhrase {
+		assert.NotEmpty(t, phrase, "status %d", code)
+		assert.NotContains(t, phrase, "HTTP/")
+	}
+
+	// Test: Unregistered code gets an empty phrase
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(299))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 299 \r\n", buf.String())
+
+	// Test: Custom reason phrase
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLineReason(StatusOK, "Everything\tFine \xe9"))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, "HTTP/1.1 200 Everything\tFine \xe9\r\n", buf.String())
+
+	// Test: Codes outside 100-999 are refused
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.Error(t, w.WriteStatusLine(99))
+	require.Error(t, w.WriteStatusLine(1000))
+	require.Error(t, w.WriteStatusLine(-200))
+	assert.Empty(t, buf.String())
+
+	// Test: Reason phrase with CRLF is refused
+	require.Error(t, w.WriteStatusLineReason(StatusOK, "OK\r\nSet-Cookie: evil=1"))
+	assert.Empty(t, buf.String())
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+}
+
+func TestWriterAutoFraming(t *testing.T) {
+	// Test: Small body gets a Content-Length
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Header().Set("Content-Type", "text/plain")
+	n, err := w.Write([]byte("hello "))
+	require.NoError(t, err)
+	assert.Equal(t, 6, n)
+	w.Write([]byte("world"))
+	assert.Empty(t, buf.String())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 11\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"hello world", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Finish is idempotent and Write after it fails
+	require.NoError(t, w.Finish())
+	_, err = w.Write([]byte("x"))
+	require.Error(t, err)
+
+	// Test: Status set with WriteHeader
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteHeader(StatusNotFound))
+	w.Write([]byte("nope"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 404 Not Found\r\nContent-Length: 4\r\n\r\nnope", buf.String())
+	require.Error(t, w.WriteHeader(StatusOK))
+
+	// Test: Empty response
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n", buf.String())
+
+	// Test: No Content-Length on 204
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.WriteHeader(StatusNoContent)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n\r\n", buf.String())
+
+	// Test: No body on 204 or 304
+	for status, want := range map[StatusCode]string{
+		StatusNoContent:   "HTTP/1.1 204 No Content\r\n\r\n",
+		StatusNotModified: "HTTP/1.1 304 Not Modified\r\n\r\n",
+	} {
+		buf.Reset()
+		w = NewWriter(&buf)
+		w.WriteHeader(status)
+		_, err = w.Write([]byte("oops"))
+		require.ErrorIs(t, err, ErrBodyNotAllowed)
+		require.NoError(t, w.Finish())
+		assert.Equal(t, want, buf.String())
+		assert.True(t, w.KeepAlive())
+	}
+
+	// Test: A body buffered before WriteHeader(204) is dropped
+	buf.Reset()
+	w = NewWriter(&buf)
+	_, err = w.Write([]byte("oops"))
+	require.NoError(t, err)
+	w.WriteHeader(StatusNoContent)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Invalid status
+	require.Error(t, NewWriter(&buf).WriteHeader(42))
+
+	// Test: Large body is streamed chunked
+	buf.Reset()
+	w = NewWriter(&buf)
+	first := bytes.Repeat([]byte("a"), bufferSize)
+	w.Write(first)
+	assert.Empty(t, buf.String())
+	w.Write([]byte("bc"))
+	w.Write([]byte("d"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"1000\r\n"+string(first)+"\r\n"+
+		"2\r\nbc\r\n"+
+		"1\r\nd\r\n"+
+		"0\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Large body to an HTTP/1.0 client is delimited by close
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetHttpVersion("1.0")
+	w.Write(first)
+	w.Write([]byte("bc"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\n"+
+		"Connection: close\r\n"+
+		"\r\n"+
+		string(first)+"bc", buf.String())
+	assert.False(t, w.KeepAlive())
+
+	// Test: Content-Length set by the handler is kept when streaming
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.Header().Set("Content-Length", "4098")
+	w.Write(first)
+	w.Write([]byte("bc"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 4098\r\n"+
+		"\r\n"+
+		string(first)+"bc", buf.String())
+
+	// Test: WriteBody can be called several times
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(10)))
+	_, err = w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteBody([]byte("world"))
+	require.NoError(t, err)
+	assert.False(t, w.KeepAlive())
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 10\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n"+
+		"helloworld", buf.String())
+
+	// Test: Finish ends a chunked body written with the low-level calls
+	buf.Reset()
+	w = NewWriter(&buf)
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	w.WriteStatusLine(StatusOK)
+	w.WriteHeaders(h)
+	w.Flush()
+	w.WriteChunkedBody([]byte("hi"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"2\r\nhi\r\n"+
+		"0\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriterBuffering(t *testing.T) {
+	// Test: Status line, headers and a small body go out in one write
+	cw := &countingWriter{}
+	w := NewWriter(cw)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, cw.writes)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, 1, cw.writes)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\nhello", cw.String())
+
+	// Test: Flush sends what is buffered
+	cw = &countingWriter{}
+	w = NewWriter(cw)
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	w.WriteStatusLine(StatusOK)
+	w.WriteHeaders(h)
+	w.WriteChunkedBody([]byte("abc"))
+	require.NoError(t, w.Flush())
+	assert.Equal(t, 1, cw.writes)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n", cw.String())
+	require.NoError(t, w.Flush())
+	assert.Equal(t, 1, cw.writes)
+
+	// Test: Large chunk goes out with the buffered output
+	large := bytes.Repeat([]byte("x"), 2*bufferSize)
+	n, err := w.WriteChunkedBody(large)
+	require.NoError(t, err)
+	assert.Equal(t, len("2000\r\n")+len(large)+len("\r\n"), n)
+	require.NoError(t, w.Finish())
+	assert.True(t, bytes.HasSuffix(cw.Bytes(), []byte("2000\r\n"+string(large)+"\r\n0\r\n\r\n")))
+
+	// Test: Interim responses are not held back
+	cw = &countingWriter{}
+	w = NewWriter(cw)
+	require.NoError(t, w.WriteContinue())
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\n", cw.String())
+
+}
+
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.writes++
+	return c.Buffer.Write(p)
+}
+
+func BenchmarkWriteResponse(b *testing.B) {
+	body := []byte("<html><body><h1>Success!</h1></body></html>")
+	cw := &countingWriter{}
+	b.ReportAllocs()
+	for b.Loop() {
+		cw.Reset()
+		w := NewWriter(cw)
+		w.WriteStatusLine(StatusOK)
+		h := GetDefaultHeaders(len(body))
+		h.Set("Content-Type", "text/html")
+		h.Set("Cache-Control", "no-cache")
+		w.WriteHeaders(h)
+		w.WriteBody(body)
+		w.Finish()
+	}
+	b.ReportMetric(float64(cw.writes)/float64(b.N), "writes/op")
+}
+
+func BenchmarkWriteAutoFramed(b *testing.B) {
+	body := []byte("<html><body><h1>Success!</h1></body></html>")
+	cw := &countingWriter{}
+	b.ReportAllocs()
+	for b.Loop() {
+		cw.Reset()
+		w := NewWriter(cw)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(body)
+		w.Finish()
+	}
+	b.ReportMetric(float64(cw.writes)/float64(b.N), "writes/op")
+}
+
+func BenchmarkWriteChunked(b *testing.B) {
+	chunk := bytes.Repeat([]byte("x"), 512)
+	cw := &countingWriter{}
+	b.ReportAllocs()
+	for b.Loop() {
+		cw.Reset()
+		w := NewWriter(cw)
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		w.WriteStatusLine(StatusOK)
+		w.WriteHeaders(h)
+		for range 16 {
+			w.WriteChunkedBody(chunk)
+		}
+		w.WriteChunkedBodyDone()
+		w.WriteTrailers(headers.NewHeaders())
+		w.Finish()
+	}
+	b.ReportMetric(float64(cw.writes)/float64(b.N), "writes/op")
+}
+
+// BenchmarkWriteChunkedTCP writes large chunks over loopback, where the
+// chunk framing and data go out in one writev.
+func BenchmarkWriteChunkedTCP(b *testing.B) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(b, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, conn)
+		conn.Close()
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(b, err)
+	defer conn.Close()
+
+	chunk := bytes.Repeat([]byte("x"), 32<<10)
+	b.SetBytes(int64(4 * len(chunk)))
+	b.ReportAllocs()
+	for b.Loop() {
+		w := NewWriter(conn)
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		w.WriteStatusLine(StatusOK)
+		w.WriteHeaders(h)
+		for range 4 {
+			w.WriteChunkedBody(chunk)
+		}
+		w.Finish()
+	}
+}
+
+func TestWriterContentLength(t *testing.T) {
+	// Test: Overflow is refused and nothing of it is sent
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.WriteStatusLine(StatusOK)
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err := w.WriteBody([]byte("hel"))
+	require.NoError(t, err)
+	n, err := w.WriteBody([]byte("lo world"))
+	require.ErrorIs(t, err, ErrBodyTooLong)
+	assert.Equal(t, 0, n)
+	_, err = w.WriteBody([]byte("lo"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello"))
+	assert.True(t, w.KeepAlive())
+
+	// Test: Underflow is reported by Finish and ends keep-alive
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.WriteStatusLine(StatusOK)
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(10)))
+	w.WriteBody([]byte("short"))
+	require.ErrorIs(t, w.Finish(), ErrBodyTooShort)
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nshort"))
+	assert.False(t, w.KeepAlive())
+
+	// Test: Write with a Content-Length set in Header
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.Header().Set("Content-Length", "3")
+	w.Write([]byte("abcd"))
+	require.ErrorIs(t, w.Finish(), ErrBodyTooLong)
+
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.Header().Set("Content-Length", "3")
+	w.Write([]byte("ab"))
+	require.ErrorIs(t, w.Finish(), ErrBodyTooShort)
+
+	// Test: Invalid Content-Length is refused
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.WriteStatusLine(StatusOK)
+	h := headers.NewHeaders()
+	h.Set("Content-Length", "abc")
+	require.Error(t, w.WriteHeaders(h))
+
+	// Test: No length to check on 304
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.WriteStatusLine(StatusNotModified)
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(100)))
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriterHead(t *testing.T) {
+	// Test: Headers as for GET, no body
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetHead(true)
+	w.WriteStatusLine(StatusOK)
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	n, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Handler that skips the body
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetHead(true)
+	w.WriteStatusLine(StatusOK)
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Declared length is still enforced
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetHead(true)
+	w.WriteStatusLine(StatusOK)
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err = w.WriteBody([]byte("hello world"))
+	require.ErrorIs(t, err, ErrBodyTooLong)
+
+	// Test: Buffered Write keeps its Content-Length
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetHead(true)
+	w.Write([]byte("hello world"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 11\r\n\r\n", buf.String())
+
+	// Test: Chunked response has no chunks or trailers
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetHead(true)
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	w.WriteStatusLine(StatusOK)
+	w.WriteHeaders(h)
+	w.WriteChunkedBody([]byte("abc"))
+	w.WriteChunkedBodyDone()
+	th := headers.NewHeaders()
+	th.Set("X-Checksum", "1")
+	require.NoError(t, w.WriteTrailers(th))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: No body means no need to close
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetHead(true)
+	w.WriteStatusLine(StatusOK)
+	w.WriteHeaders(headers.NewHeaders())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+}
+
+func TestWriterCompression(t *testing.T) {
+	text := strings.Repeat("hello compression ", 200)
+
+	// Test: Buffered body is compressed with a Content-Length
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	require.NoError(t, w.SetCompression("gzip"))
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("ETag", `"abc"`)
+	w.Write([]byte(text[:2000]))
+	require.NoError(t, w.Finish())
+	head, body, _ := strings.Cut(buf.String(), "\r\n\r\n")
+	head += "\r\n"
+	assert.Contains(t, head, "Content-Encoding: gzip\r\n")
+	assert.Contains(t, head, "Vary: Accept-Encoding\r\n")
+	assert.Contains(t, head, "ETag: W/\"abc\"\r\n")
+	assert.Contains(t, head, "Content-Length: "+strconv.Itoa(len(body))+"\r\n")
+	assert.Less(t, len(body), 2000)
+	assert.Equal(t, text[:2000], gunzip(t, body))
+	assert.True(t, w.KeepAlive())
+
+	// Test: Streamed body is compressed chunked
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetCompression("gzip")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(text))
+	w.Write([]byte(text))
+	require.NoError(t, w.Finish())
+	head, body, _ = strings.Cut(buf.String(), "\r\n\r\n")
+	head += "\r\n"
+	assert.Contains(t, head, "Transfer-Encoding: chunked\r\n")
+	assert.Contains(t, head, "Content-Encoding: gzip\r\n")
+	assert.NotContains(t, head, "Content-Length")
+	assert.Equal(t, text+text, gunzip(t, dechunk(t, body)))
+	assert.True(t, w.KeepAlive())
+
+	// Test: Declared Content-Length is replaced by chunked
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetCompression("deflate")
+	w.WriteStatusLine(StatusOK)
+	h := GetDefaultHeaders(len(text))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteBody([]byte(text))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	head, body, _ = strings.Cut(buf.String(), "\r\n\r\n")
+	head += "\r\n"
+	assert.Contains(t, head, "Transfer-Encoding: chunked\r\n")
+	assert.Contains(t, head, "Content-Encoding: deflate\r\n")
+	assert.NotContains(t, head, "Content-Length")
+	zr, err := zlib.NewReader(strings.NewReader(dechunk(t, body)))
+	require.NoError(t, err)
+	out, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Equal(t, text, string(out))
+
+	// Test: Small body is left alone
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetCompression("gzip")
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte("<p>hi</p>"))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 9\r\n"+
+		"Content-Type: text/html\r\n"+
+		"Vary: Accept-Encoding\r\n"+
+		"\r\n"+
+		"<p>hi</p>", buf.String())
+
+	// Test: Incompressible type, existing encoding and no-transform
+	for _, set := range [][2]string{
+		{"Content-Type", "image/png"},
+		{"Content-Encoding", "br"},
+		{"Cache-Control", "no-transform"},
+	} {
+		buf.Reset()
+		w = NewWriter(&buf)
+		w.SetCompression("gzip")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set(set[0], set[1])
+		w.Write([]byte(text[:2000]))
+		require.NoError(t, w.Finish())
+		assert.True(t, strings.HasSuffix(buf.String(), text[:2000]), set[0])
+	}
+
+	// Test: No coding accepted still varies
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetCompression("")
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(text[:2000]))
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "Vary: Accept-Encoding\r\n")
+	assert.NotContains(t, buf.String(), "Content-Encoding")
+
+	// Test: HEAD has the headers of the compressed GET
+	buf.Reset()
+	w = NewWriter(&buf)
+	w.SetHead(true)
+	w.SetCompression("gzip")
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(text))
+	w.Write([]byte(text))
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Vary: Accept-Encoding\r\n"+
+		"Content-Encoding: gzip\r\n"+
+		"\r\n", buf.String())
+
+	// Test: Unknown coding
+	require.Error(t, NewWriter(&buf).SetCompression("br"))
+}
+
+func gunzip(t *testing.T, s string) string {
+	t.Helper()
+	zr, err := gzip.NewReader(strings.NewReader(s))
+	require.NoError(t, err)
+	out, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	return string(out)
+}
+
+func dechunk(t *testing.T, s string) string {
+	t.Helper()
+	out, err := io.ReadAll(httputil.NewChunkedReader(strings.NewReader(s)))
+	require.NoError(t, err)
+	return string(out)
+}
+
+// tcpPair returns both ends of a loopback TCP connection.
+func tcpPair(tb testing.TB) (server, client net.Conn) {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(tb, err)
+	defer ln.Close()
+	accepted := make(chan net.Conn)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+	client, err = net.Dial("tcp", ln.Addr().String())
+	require.NoError(tb, err)
+	server = <-accepted
+	require.NotNil(tb, server)
+	tb.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return server, client
+}
+
+func tempFile(tb testing.TB, data []byte) *os.File {
+	tb.Helper()
+	f, err := os.CreateTemp(tb.TempDir(), "body")
+	require.NoError(tb, err)
+	_, err = f.Write(data)
+	require.NoError(tb, err)
+	tb.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestWriterReadFrom(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	f := tempFile(t, data)
+
+	// Test: File section over TCP
+	serverConn, clientConn := tcpPair(t)
+	w := NewWriter(serverConn)
+	w.Header().Set("Content-Length", "1000")
+	n, err := w.WriteFile(f, 500, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), n)
+	require.NoError(t, w.Finish())
+	assert.True(t, w.KeepAlive())
+	serverConn.Close()
+	got, err := io.ReadAll(clientConn)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 1000\r\n\r\n"+string(data[500:1500]), string(got))
+
+	// Test: Whole file through io.Copy with the length enforced
+	serverConn, clientConn = tcpPair(t)
+	w = NewWriter(serverConn)
+	w.WriteStatusLine(StatusOK)
+	w.WriteHeaders(GetDefaultHeaders(len(data) - 1))
+	f.Seek(0, io.SeekStart)
+	_, err = io.Copy(w, f)
+	require.ErrorIs(t, err, ErrBodyTooLong)
+
+	// Test: Without a TCP connection it falls back to Write
+	var buf bytes.Buffer
+	w = NewWriter(&buf)
+	w.WriteStatusLine(StatusOK)
+	w.WriteHeaders(GetDefaultHeaders(100))
+	n, err = w.WriteFile(f, 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), n)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"+string(data[:100])))
+
+	// Test: Chunked bodies keep their framing
+	serverConn, clientConn = tcpPair(t)
+	w = NewWriter(serverConn)
+	w.Header().Set("Transfer-Encoding", "chunked")
+	_, err = w.WriteFile(f, 0, 10)
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	serverConn.Close()
+	got, err = io.ReadAll(clientConn)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\na\r\n0123456789\r\n0\r\n\r\n", string(got))
+}
+
+func benchmarkFile(b *testing.B, size int, write func(w *Writer, f *os.File, name string)) {
+	f := tempFile(b, bytes.Repeat([]byte("x"), size))
+	serverConn, clientConn := tcpPair(b)
+	go io.Copy(io.Discard, clientConn)
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	for b.Loop() {
+		w := NewWriter(serverConn)
+		w.WriteStatusLine(StatusOK)
+		w.WriteHeaders(GetDefaultHeaders(size))
+		write(w, f, f.Name())
+		if err := w.Finish(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFileReadFile(b *testing.B) {
+	benchmarkFile(b, 4<<20, func(w *Writer, _ *os.File, name string) {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		w.WriteBody(data)
+	})
+}
+
+func BenchmarkFileSendfile(b *testing.B) {
+	benchmarkFile(b, 4<<20, func(w *Writer, f *os.File, _ string) {
+		if _, err := w.WriteFile(f, 0, 4<<20); err != nil {
+			b.Fatal(err)
+		}
+	})
+}
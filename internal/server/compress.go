@@ -0,0 +1,86 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/iferdel-vault/tcptohttp/internal/request"
+	"github.com/iferdel-vault/tcptohttp/internal/response"
+)
+
+// supportedEncodings are the content codings Compress can apply, in order
+// of preference when the client rates them equally.
+var supportedEncodings = []string{"gzip", "deflate"}
+
+// Compress returns a handler that lets the responses of next be compressed
+// with the coding the client prefers among gzip and deflate. The writer
+// only compresses bodies of compressible types that are large enough, and
+// adds Vary: Accept-Encoding to every response.
+func Compress(next Handler) Handler {
+	return func(w *response.Writer, r *request.Request) {
+		accept, _ := r.Headers.Get("Accept-Encoding")
+		w.SetCompression(negotiateEncoding(accept))
+		next(w, r)
+	}
+}
+
+// negotiateEncoding picks the supported coding with the highest q-value in
+// an Accept-Encoding header (RFC 9110 §12.5.3), or "" if the client accepts
+// none of them or rates identity higher.
+func negotiateEncoding(accept string) string {
+	qs := parseAcceptEncoding(accept)
+	best, bestQ := "", 0.0
+	for _, coding := range supportedEncodings {
+		q := encodingQ(qs, coding)
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	if q, ok := qs["identity"]; ok && q > bestQ {
+		return ""
+	}
+	return best
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header allows coding.
+func acceptsEncoding(accept, coding string) bool {
+	return encodingQ(parseAcceptEncoding(accept), coding) > 0
+}
+
+// parseAcceptEncoding maps each coding in an Accept-Encoding header,
+// lower-cased, to its q-value. Malformed q-values count as 0.
+func parseAcceptEncoding(accept string) map[string]float64 {
+	qs := make(map[string]float64)
+	for _, item := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(item, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		if coding == "x-gzip" {
+			coding = "gzip"
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(param, "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(key), "q") {
+				continue
+			}
+			var err error
+			q, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || q < 0 || q > 1 {
+				q = 0
+			}
+		}
+		qs[coding] = q
+	}
+	return qs
+}
+
+// encodingQ returns the q-value for coding, falling back to that of "*".
+func encodingQ(qs map[string]float64, coding string) float64 {
+	if q, ok := qs[coding]; ok {
+		return q
+	}
+	return qs["*"]
+}
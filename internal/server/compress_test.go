@@ -0,0 +1,87 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/iferdel-vault/tcptohttp/internal/request"
+	"github.com/iferdel-vault/tcptohttp/internal/response"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: ""},
+		{accept: "gzip", want: "gzip"},
+		{accept: "deflate", want: "deflate"},
+		{accept: "gzip, deflate", want: "gzip"},
+		{accept: "deflate, gzip", want: "gzip"},
+		{accept: "gzip;q=0.5, deflate", want: "deflate"},
+		{accept: "GZIP;Q=0.8", want: "gzip"},
+		{accept: "x-gzip", want: "gzip"},
+		{accept: "br", want: ""},
+		{accept: "*", want: "gzip"},
+		{accept: "*;q=0.5, gzip;q=0", want: "deflate"},
+		{accept: "gzip;q=0", want: ""},
+		{accept: "gzip;q=2", want: ""},
+		{accept: "gzip;q=abc", want: ""},
+		{accept: "identity, gzip;q=0.5", want: ""},
+		{accept: "identity;q=0.1, gzip;q=0.5", want: "gzip"},
+		{accept: " , gzip ; q=0.3 ,", want: "gzip"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, negotiateEncoding(tt.accept), tt.accept)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	page := strings.Repeat("<p>compress me</p>", 100)
+	handler := Compress(func(w *response.Writer, _ *request.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(page))
+	})
+
+	// Test: Client accepting gzip
+	got := serve(t, handler, "GET", "/", "Accept-Encoding: gzip, deflate")
+	assert.Contains(t, got, "Content-Encoding: gzip\r\n")
+	assert.Contains(t, got, "Vary: Accept-Encoding\r\n")
+
+	// Test: Client without Accept-Encoding
+	got = serve(t, handler, "GET", "/")
+	assert.NotContains(t, got, "Content-Encoding")
+	assert.Contains(t, got, "Vary: Accept-Encoding\r\n")
+	assert.True(t, strings.HasSuffix(got, page))
+}
+
+func TestFileServerPrecompressed(t *testing.T) {
+	modtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"app.js":    {Data: []byte("console.log(1)"), ModTime: modtime},
+		"app.js.gz": {Data: []byte("\x1f\x8bfake"), ModTime: modtime},
+		"plain.css": {Data: []byte("body{}"), ModTime: modtime},
+	}
+	files := Compress(FileServer(fsys, FileServerOptions{}))
+	// Test: The .gz copy is served to clients accepting gzip
+	got := serve(t, files, "GET", "/app.js", "Accept-Encoding: gzip")
+	assert.Contains(t, got, "Content-Type: text/javascript; charset=utf-8\r\n")
+	assert.Contains(t, got, "Content-Encoding: gzip\r\n")
+	assert.Contains(t, got, "Vary: Accept-Encoding\r\n")
+	assert.Equal(t, 1, strings.Count(got, "Vary:"))
+	assert.True(t, strings.HasSuffix(got, "\r\n\r\n\x1f\x8bfake"))
+
+	// Test: The original is served to others
+	got = serve(t, files, "GET", "/app.js", "Accept-Encoding: deflate, gzip;q=0")
+	assert.NotContains(t, got, "Content-Encoding")
+	assert.Contains(t, got, "Vary: Accept-Encoding\r\n")
+	assert.True(t, strings.HasSuffix(got, "\r\n\r\nconsole.log(1)"))
+
+	// Test: Files without a copy
+	got = serve(t, files, "GET", "/plain.css", "Accept-Encoding: gzip")
+	assert.NotContains(t, got, "Content-Encoding")
+	assert.True(t, strings.HasSuffix(got, "\r\n\r\nbody{}"))
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iferdel-vault/tcptohttp/internal/request"
+	"github.com/iferdel-vault/tcptohttp/internal/response"
+)
+
+// StrongETag returns a strong entity-tag derived from the content itself,
+// for responses whose bytes are known up front.
+func StrongETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// WeakETag returns a weak entity-tag derived from the size and modification
+// time of the content, for files that are too large to hash per request.
+func WeakETag(size int64, modtime time.Time) string {
+	return `W/"` + strconv.FormatInt(size, 16) + "-" + strconv.FormatInt(modtime.UnixNano(), 16) + `"`
+}
+
+// CheckPreconditions sets ETag and Last-Modified on the response from etag
+// and modtime, either of which may be empty, and evaluates the conditional
+// headers of r in the order of RFC 9110 §13.2.2. If a condition fails it
+// answers with 304 (Not Modified) or 412 (Precondition Failed) and returns
+// true, in which case the handler must not write anything else.
+//
+// Call it only when the response would otherwise be 2xx.
+func CheckPreconditions(w *response.Writer, r *request.Request, etag string, modtime time.Time) bool {
+	h := w.Header()
+	if etag != "" {
+		h.Set("ETag", etag)
+	}
+	if !modtime.IsZero() {
+		h.Set("Last-Modified", modtime.UTC().Format(response.TimeFormat))
+	}
+	method := r.RequestLine.Method
+
+	if ifMatch, ok := r.Headers.Get("If-Match"); ok {
+		if !matchETag(ifMatch, etag, false) {
+			writeStatus(w, response.StatusPreconditionFailed, "Precondition Failed")
+			return true
+		}
+	} else if since, ok := r.Headers.Get("If-Unmodified-Since"); ok {
+		t, err := parseHTTPDate(since)
+		if err == nil && !modtime.IsZero() && modtime.Truncate(time.Second).After(t) {
+			writeStatus(w, response.StatusPreconditionFailed, "Precondition Failed")
+			return true
+		}
+	}
+
+	if ifNoneMatch, ok := r.Headers.Get("If-None-Match"); ok {
+		if matchETag(ifNoneMatch, etag, true) {
+			if method == "GET" || method == "HEAD" {
+				writeNotModified(w)
+			} else {
+				writeStatus(w, response.StatusPreconditionFailed, "Precondition Failed")
+			}
+			return true
+		}
+	} else if since, ok := r.Headers.Get("If-Modified-Since"); ok && (method == "GET" || method == "HEAD") {
+		t, err := parseHTTPDate(since)
+		if err == nil && !modtime.IsZero() && !modtime.Truncate(time.Second).After(t) {
+			writeNotModified(w)
+			return true
+		}
+	}
+	return false
+}
+
+// matchETag reports whether the If-Match or If-None-Match list matches
+// etag, the current entity-tag, using the weak comparison if weak is set and
+// the strong one otherwise (RFC 9110 §8.8.3.2). "*" matches any current
+// representation.
+func matchETag(list, etag string, weak bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+		if candidate == etag && !strings.HasPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified answers with 304 (Not Modified), keeping the validators
+// but none of the fields that describe a body.
+func writeNotModified(w *response.Writer) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	if _, ok := h.Get("ETag"); ok {
+		h.Del("Last-Modified")
+	}
+	w.WriteHeader(response.StatusNotModified)
+}
+
+// httpDateFormats are the formats an HTTP-date may arrive in: IMF-fixdate
+// and the two obsolete ones recipients must still accept (RFC 9110 §5.6.7).
+var httpDateFormats = []string{
+	response.TimeFormat,
+	"Monday, 02-Jan-06 15:04:05 GMT",
+	time.ANSIC,
+}
+
+func parseHTTPDate(s string) (time.Time, error) {
+	var err error
+	for _, layout := range httpDateFormats {
+		var t time.Time
+		t, err = time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iferdel-vault/tcptohttp/internal/request"
+	"github.com/iferdel-vault/tcptohttp/internal/response"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETags(t *testing.T) {
+	// Test: Strong tag depends on the content
+	a := StrongETag([]byte("hello"))
+	assert.True(t, strings.HasPrefix(a, `"`))
+	assert.Equal(t, a, StrongETag([]byte("hello")))
+	assert.NotEqual(t, a, StrongETag([]byte("hello!")))
+
+	// Test: Weak tag depends on size and time
+	modtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	w := WeakETag(10, modtime)
+	assert.True(t, strings.HasPrefix(w, `W/"`))
+	assert.NotEqual(t, w, WeakETag(11, modtime))
+	assert.NotEqual(t, w, WeakETag(10, modtime.Add(time.Second)))
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	const etag = `"v1"`
+	modtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		method     string
+		headers    []string
+		etag       string
+		wantStatus string
+	}{
+		{name: "no conditions", method: "GET", etag: etag},
+		{name: "If-None-Match matches", method: "GET", headers: []string{"If-None-Match: \"v0\", \"v1\""}, etag: etag, wantStatus: "304 Not Modified"},
+		{name: "If-None-Match weak comparison", method: "GET", headers: []string{"If-None-Match: W/\"v1\""}, etag: etag, wantStatus: "304 Not Modified"},
+		{name: "If-None-Match star", method: "HEAD", headers: []string{"If-None-Match: *"}, etag: etag, wantStatus: "304 Not Modified"},
+		{name: "If-None-Match differs", method: "GET", headers: []string{"If-None-Match: \"v0\""}, etag: etag},
+		{name: "If-None-Match on POST", method: "POST", headers: []string{"If-None-Match: \"v1\""}, etag: etag, wantStatus: "412 Precondition Failed"},
+		{name: "If-Match matches", method: "PUT", headers: []string{"If-Match: \"v1\""}, etag: etag},
+		{name: "If-Match differs", method: "PUT", headers: []string{"If-Match: \"v0\""}, etag: etag, wantStatus: "412 Precondition Failed"},
+		{name: "If-Match strong comparison", method: "PUT", headers: []string{"If-Match: W/\"v1\""}, etag: `W/"v1"`, wantStatus: "412 Precondition Failed"},
+		{name: "If-Match star", method: "PUT", headers: []string{"If-Match: *"}, etag: etag},
+		{name: "If-Modified-Since same time", method: "GET", headers: []string{"If-Modified-Since: Wed, 01 May 2024 12:00:00 GMT"}, wantStatus: "304 Not Modified"},
+		{name: "If-Modified-Since obsolete format", method: "GET", headers: []string{"If-Modified-Since: Wednesday, 01-May-24 12:00:00 GMT"}, wantStatus: "304 Not Modified"},
+		{name: "If-Modified-Since asctime format", method: "GET", headers: []string{"If-Modified-Since: Wed May  1 12:00:00 2024"}, wantStatus: "304 Not Modified"},
+		{name: "If-Modified-Since earlier", method: "GET", headers: []string{"If-Modified-Since: Tue, 30 Apr 2024 12:00:00 GMT"}},
+		{name: "If-Modified-Since invalid date", method: "GET", headers: []string{"If-Modified-Since: yesterday"}},
+		{name: "If-Modified-Since ignored for POST", method: "POST", headers: []string{"If-Modified-Since: Wed, 01 May 2024 12:00:00 GMT"}},
+		{name: "If-None-Match wins over If-Modified-Since", method: "GET", headers: []string{"If-None-Match: \"v0\"", "If-Modified-Since: Wed, 01 May 2024 12:00:00 GMT"}, etag: etag},
+		{name: "If-Unmodified-Since later", method: "PUT", headers: []string{"If-Unmodified-Since: Thu, 02 May 2024 12:00:00 GMT"}},
+		{name: "If-Unmodified-Since earlier", method: "PUT", headers: []string{"If-Unmodified-Since: Tue, 30 Apr 2024 12:00:00 GMT"}, wantStatus: "412 Precondition Failed"},
+		{name: "If-Match wins over If-Unmodified-Since", method: "PUT", headers: []string{"If-Match: \"v1\"", "If-Unmodified-Since: Tue, 30 Apr 2024 12:00:00 GMT"}, etag: etag},
+		{name: "If-Match before If-None-Match", method: "GET", headers: []string{"If-Match: \"v0\"", "If-None-Match: \"v1\""}, etag: etag, wantStatus: "412 Precondition Failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var done bool
+			got := serve(t, func(w *response.Writer, r *request.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				done = CheckPreconditions(w, r, tt.etag, modtime)
+			}, tt.method, "/", tt.headers...)
+			if tt.wantStatus == "" {
+				assert.False(t, done)
+				assert.True(t, strings.HasPrefix(got, "HTTP/1.1 200 OK\r\n"))
+				return
+			}
+			assert.True(t, done)
+			assert.True(t, strings.HasPrefix(got, "HTTP/1.1 "+tt.wantStatus+"\r\n"), got)
+		})
+	}
+
+	// Test: 304 keeps the validators and drops the body fields
+	got := serve(t, func(w *response.Writer, r *request.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Cache-Control", "no-cache")
+		assert.True(t, CheckPreconditions(w, r, etag, modtime))
+	}, "GET", "/", `If-None-Match: "v1"`)
+	// no "Connection: close": the connection stays usable
+	assert.Equal(t, "HTTP/1.1 304 Not Modified\r\n"+
+		"Cache-Control: no-cache\r\n"+
+		"ETag: \"v1\"\r\n"+
+		"\r\n", got)
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iferdel-vault/tcptohttp/internal/headers"
+	"github.com/iferdel-vault/tcptohttp/internal/request"
+	"github.com/iferdel-vault/tcptohttp/internal/response"
+)
+
+// ServeContent answers r with content. The Content-Type comes from the
+// extension of name, or from sniffing the first bytes of content, unless
+// the handler already set one. modtime, if not
+// zero, is sent as Last-Modified, and an ETag set by the handler is kept;
+// otherwise a weak one is made from the size and modtime. Conditional
+// requests are answered by CheckPreconditions.
+//
+// GET requests with a Range header get 206 (Partial Content), as a
+// multipart/byteranges body when several ranges are asked for, or 416
+// (Range Not Satisfiable) when no range overlaps the content. content is
+// read with Seek, so only the requested bytes are read.
+func ServeContent(w *response.Writer, r *request.Request, name string, modtime time.Time, content io.ReadSeeker) {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		writeStatus(w, response.StatusInternalServerError, "seeker can't seek")
+		return
+	}
+	h := w.Header()
+	ctype, ok := h.Get("Content-Type")
+	if !ok {
+		ctype = mime.TypeByExtension(filepath.Ext(name))
+		if ctype == "" {
+			var buf [sniffLen]byte
+			_, err = content.Seek(0, io.SeekStart)
+			if err != nil {
+				writeStatus(w, response.StatusInternalServerError, "seeker can't seek")
+				return
+			}
+			n, _ := io.ReadFull(content, buf[:])
+			ctype = sniffContentType(buf[:n])
+		}
+		h.Set("Content-Type", ctype)
+	}
+	h.Set("Accept-Ranges", "bytes")
+	etag, ok := h.Get("ETag")
+	if !ok && !modtime.IsZero() {
+		etag = WeakETag(size, modtime)
+	}
+	if CheckPreconditions(w, r, etag, modtime) {
+		return
+	}
+
+	var ranges []httpRange
+	rangeHeader, ok := r.Headers.Get("Range")
+	if ok && r.RequestLine.Method == "GET" && ifRangeMatches(r, h, modtime) {
+		ranges, err = parseRange(rangeHeader, size)
+		if err != nil {
+			h.Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+			writeStatus(w, response.StatusRangeNotSatisfiable, err.Error())
+			return
+		}
+		if sumRangesSize(ranges) > size {
+			// asking for more than the whole content is more likely an
+			// attack than a client that needs it
+			ranges = nil
+		}
+	}
+	sendBody := r.RequestLine.Method != "HEAD"
+
+	switch len(ranges) {
+	case 0:
+		h.Set("Content-Length", strconv.FormatInt(size, 10))
+		w.WriteHeader(response.StatusOK)
+		if sendBody {
+			copyRange(w, content, httpRange{start: 0, length: size})
+		}
+	case 1:
+		ra := ranges[0]
+		h.Set("Content-Range", ra.contentRange(size))
+		h.Set("Content-Length", strconv.FormatInt(ra.length, 10))
+		w.WriteHeader(response.StatusPartialContent)
+		if sendBody {
+			copyRange(w, content, ra)
+		}
+	default:
+		boundary := multipart.NewWriter(io.Discard).Boundary()
+		h.Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+		h.Set("Content-Length", strconv.FormatInt(multipartLength(ranges, ctype, size, boundary), 10))
+		w.WriteHeader(response.StatusPartialContent)
+		if sendBody {
+			writeMultipart(w, content, ranges, ctype, size, boundary)
+		}
+	}
+}
+
+// ifRangeMatches reports whether a Range header should be honored given the
+// If-Range header, if any (RFC 9110 §13.1.5). An entity-tag must match the
+// ETag set on the response with the strong comparison and a date must be
+// exactly modtime.
+func ifRangeMatches(r *request.Request, h *headers.Headers, modtime time.Time) bool {
+	ifRange, ok := r.Headers.Get("If-Range")
+	if !ok {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		// a weak entity-tag never validates a range
+		etag, ok := h.Get("ETag")
+		return ok && strings.HasPrefix(ifRange, `"`) && ifRange == etag
+	}
+	t, err := parseHTTPDate(ifRange)
+	return err == nil && !modtime.IsZero() && t.Equal(modtime.Truncate(time.Second))
+}
+
+func copyRange(w io.Writer, content io.ReadSeeker, ra httpRange) error {
+	_, err := content.Seek(ra.start, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(w, content, ra.length)
+	return err
+}
+
+func partHeader(ra httpRange, ctype string, size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Range": {ra.contentRange(size)},
+		"Content-Type":  {ctype},
+	}
+}
+
+func writeMultipart(w io.Writer, content io.ReadSeeker, ranges []httpRange, ctype string, size int64, boundary string) error {
+	mw := multipart.NewWriter(w)
+	err := mw.SetBoundary(boundary)
+	if err != nil {
+		return err
+	}
+	for _, ra := range ranges {
+		part, err := mw.CreatePart(partHeader(ra, ctype, size))
+		if err != nil {
+			return err
+		}
+		err = copyRange(part, content, ra)
+		if err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// multipartLength returns the length of the body writeMultipart writes.
+func multipartLength(ranges []httpRange, ctype string, size int64, boundary string) int64 {
+	var cw countingWriter
+	mw := multipart.NewWriter(&cw)
+	mw.SetBoundary(boundary)
+	for _, ra := range ranges {
+		mw.CreatePart(partHeader(ra, ctype, size))
+		cw += countingWriter(ra.length)
+	}
+	mw.Close()
+	return int64(cw)
+}
+
+type countingWriter int64
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	*c += countingWriter(len(p))
+	return len(p), nil
+}
+
+// writeStatus answers with a plain text message.
+func writeStatus(w *response.Writer, statusCode response.StatusCode, message string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(statusCode)
+	w.Write([]byte(message))
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/iferdel-vault/tcptohttp/internal/request"
+	"github.com/iferdel-vault/tcptohttp/internal/response"
+)
+
+const indexPage = "index.html"
+
+// FileServerOptions configures FileServer.
+type FileServerOptions struct {
+	// StripPrefix is removed from the request path before the file is
+	// looked up. Requests outside it get 404 (Not Found).
+	StripPrefix string
+	// ListDirectories answers requests for a directory without an
+	// index.html with a listing of its entries instead of 404.
+	ListDirectories bool
+}
+
+// FileServer returns a handler that serves the files of fsys, which can be
+// an os.DirFS for a directory on disk or an embed.FS. Request paths are
+// looked up below the root of fsys and paths with ".." segments are
+// refused. A directory is served through its index.html, and files are
+// streamed with ServeContent, so Range and conditional requests work.
+func FileServer(fsys fs.FS, opts FileServerOptions) Handler {
+	return func(w *response.Writer, r *request.Request) {
+		method := r.RequestLine.Method
+		if method != "GET" && method != "HEAD" {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeStatus(w, response.StatusMethodNotAllowed, "Method Not Allowed")
+			return
+		}
+		p := r.RequestLine.Target.Path
+		if opts.StripPrefix != "" {
+			rest, ok := strings.CutPrefix(p, opts.StripPrefix)
+			if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+				writeStatus(w, response.StatusNotFound, "Not Found")
+				return
+			}
+			p = rest
+		}
+		name, ok := fileName(p)
+		if !ok {
+			writeStatus(w, response.StatusBadRequest, "Invalid path")
+			return
+		}
+		if name != "." && strings.HasSuffix(p, "/") {
+			// only directories are asked for with a trailing slash
+			info, err := fs.Stat(fsys, name)
+			if err == nil && !info.IsDir() {
+				writeStatus(w, response.StatusNotFound, "Not Found")
+				return
+			}
+		}
+		serveFile(w, r, fsys, name, opts.ListDirectories)
+	}
+}
+
+// ServeFile answers r with the file called name in fsys, streamed with
+// ServeContent. A name that is a directory is served through its
+// index.html.
+func ServeFile(w *response.Writer, r *request.Request, fsys fs.FS, name string) {
+	if !fs.ValidPath(name) {
+		writeStatus(w, response.StatusBadRequest, "Invalid path")
+		return
+	}
+	serveFile(w, r, fsys, name, false)
+}
+
+// fileName turns a decoded request path into a name for fs.FS. It refuses
+// paths that climb out with ".." or hold characters no file name has.
+func fileName(p string) (string, bool) {
+	if strings.ContainsAny(p, "\x00\\") {
+		return "", false
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." {
+			return "", false
+		}
+	}
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name == "" {
+		name = "."
+	}
+	return name, fs.ValidPath(name)
+}
+
+func serveFile(w *response.Writer, r *request.Request, fsys fs.FS, name string, listDirectories bool) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+
+	if info.IsDir() {
+		target := r.RequestLine.Target
+		if !strings.HasSuffix(target.Path, "/") {
+			// relative links in the page only work from "dir/"
+			location := target.RawPath + "/"
+			if target.RawQuery != "" {
+				location += "?" + target.RawQuery
+			}
+			w.Header().Set("Location", location)
+			writeStatus(w, response.StatusMovedPermanently, "Moved Permanently")
+			return
+		}
+		index, indexInfo, ok := openIndex(fsys, name)
+		if !ok {
+			if !listDirectories {
+				writeStatus(w, response.StatusNotFound, "Not Found")
+				return
+			}
+			listDirectory(w, r, fsys, name)
+			return
+		}
+		defer index.Close()
+		f, info = index, indexInfo
+		name = path.Join(name, indexPage)
+	}
+
+	gz, gzInfo, ok := openPrecompressed(w, r, fsys, name)
+	if ok {
+		defer gz.Close()
+		f, info = gz, gzInfo
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if ok {
+		ServeContent(w, r, path.Base(name), info.ModTime(), content)
+		return
+	}
+	// without Seek the file can only be sent whole, from the start
+	if CheckPreconditions(w, r, WeakETag(info.Size(), info.ModTime()), info.ModTime()) {
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	if _, ok := h.Get("Content-Type"); !ok {
+		ctype := mime.TypeByExtension(path.Ext(name))
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		h.Set("Content-Type", ctype)
+	}
+	w.WriteHeader(response.StatusOK)
+	if r.RequestLine.Method != "HEAD" {
+		io.CopyN(w, f, info.Size())
+	}
+}
+
+// openPrecompressed looks for a gzip-compressed copy of the file name,
+// called name.gz. If there is one the response varies on Accept-Encoding,
+// and if the client accepts gzip the copy is opened, with the headers set
+// to serve it as the gzip coding of name.
+func openPrecompressed(w *response.Writer, r *request.Request, fsys fs.FS, name string) (fs.File, fs.FileInfo, bool) {
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if ctype == "" || path.Ext(name) == ".gz" {
+		// the type could only be sniffed from the uncompressed file
+		return nil, nil, false
+	}
+	info, err := fs.Stat(fsys, name+".gz")
+	if err != nil || info.IsDir() {
+		return nil, nil, false
+	}
+	h := w.Header()
+	if !h.HasToken("Vary", "Accept-Encoding") {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	accept, _ := r.Headers.Get("Accept-Encoding")
+	if !acceptsEncoding(accept, "gzip") {
+		return nil, nil, false
+	}
+	f, err := fsys.Open(name + ".gz")
+	if err != nil {
+		return nil, nil, false
+	}
+	if _, ok := h.Get("Content-Type"); !ok {
+		h.Set("Content-Type", ctype)
+	}
+	h.Set("Content-Encoding", "gzip")
+	return f, info, true
+}
+
+// openIndex opens the index.html of the directory name, if it has one.
+func openIndex(fsys fs.FS, name string) (fs.File, fs.FileInfo, bool) {
+	f, err := fsys.Open(path.Join(name, indexPage))
+	if err != nil {
+		return nil, nil, false
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, nil, false
+	}
+	return f, info, true
+}
+
+func listDirectory(w *response.Writer, r *request.Request, fsys fs.FS, name string) {
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+	title := html.EscapeString(r.RequestLine.Target.Path)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!doctype html>\n<html>\n<head><title>Index of %s</title></head>\n<body>\n<h1>Index of %s</h1>\n<ul>\n", title, title)
+	if name != "." {
+		fmt.Fprintf(w, "<li><a href=\"../\">../</a></li>\n")
+	}
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		// a name with a colon would otherwise read as a URL scheme
+		href := (&url.URL{Path: "./" + entryName}).EscapedPath()
+		fmt.Fprintf(w, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(href), html.EscapeString(entryName))
+	}
+	fmt.Fprintf(w, "</ul>\n</body>\n</html>\n")
+}
+
+func writeFSError(w *response.Writer, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		writeStatus(w, response.StatusNotFound, "Not Found")
+	case errors.Is(err, fs.ErrPermission):
+		writeStatus(w, response.StatusForbidden, "Forbidden")
+	default:
+		writeStatus(w, response.StatusInternalServerError, "Internal Server Error")
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/iferdel-vault/tcptohttp/internal/request"
+	"github.com/iferdel-vault/tcptohttp/internal/response"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileServer(t *testing.T) {
+	modtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"index.html":         {Data: []byte("<html>home</html>"), ModTime: modtime},
+		"style.css":          {Data: []byte("body{}"), ModTime: modtime},
+		"notes":              {Data: []byte("just some text"), ModTime: modtime},
+		"blob":               {Data: []byte{0, 1, 2, 3}, ModTime: modtime},
+		"docs/guide.html":    {Data: []byte("<p>guide</p>"), ModTime: modtime},
+		"docs/a <b>.txt":     {Data: []byte("x"), ModTime: modtime},
+		"docs/sub/index.htm": {Data: []byte("x"), ModTime: modtime},
+		"site/index.html":    {Data: []byte("<p>site</p>"), ModTime: modtime},
+	}
+	files := FileServer(fsys, FileServerOptions{})
+
+	// Test: File with its type from the extension
+	got := serve(t, files, "GET", "/style.css")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, got, "Content-Type: text/css; charset=utf-8\r\n")
+	assert.Contains(t, got, "Content-Length: 6\r\n")
+	assert.Contains(t, got, "Last-Modified: Wed, 01 May 2024 12:00:00 GMT\r\n")
+	assert.True(t, strings.HasSuffix(got, "\r\n\r\nbody{}"))
+
+	// Test: Type sniffed when there is no extension
+	got = serve(t, files, "GET", "/notes")
+	assert.Contains(t, got, "Content-Type: text/plain; charset=utf-8\r\n")
+	got = serve(t, files, "GET", "/blob")
+	assert.Contains(t, got, "Content-Type: application/octet-stream\r\n")
+
+	// Test: Root is served through index.html
+	got = serve(t, files, "GET", "/")
+	assert.True(t, strings.HasSuffix(got, "\r\n\r\n<html>home</html>"))
+	got = serve(t, files, "GET", "/site/")
+	assert.True(t, strings.HasSuffix(got, "\r\n\r\n<p>site</p>"))
+
+	// Test: Directory without a trailing slash is redirected
+	got = serve(t, files, "GET", "/site?x=1")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 301 Moved Permanently\r\n"))
+	assert.Contains(t, got, "Location: /site/?x=1\r\n")
+
+	// Test: File with a trailing slash
+	got = serve(t, files, "GET", "/style.css/")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Missing file
+	got = serve(t, files, "GET", "/missing.html")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Directory without index and listing disabled
+	got = serve(t, files, "GET", "/docs/")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: Traversal is refused
+	for _, target := range []string{"/../etc/passwd", "/docs/../../etc/passwd", "/%2e%2e/etc/passwd", "/docs/..%2f..%2fetc/passwd", "/a%5c..%5cb", "/a%00"} {
+		got = serve(t, files, "GET", target)
+		assert.True(t, strings.HasPrefix(got, "HTTP/1.1 400 Bad Request\r\n"), target)
+	}
+
+	// Test: Only GET and HEAD
+	got = serve(t, files, "DELETE", "/style.css")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 405 Method Not Allowed\r\n"))
+	assert.Contains(t, got, "Allow: GET, HEAD\r\n")
+
+	// Test: HEAD
+	got = serve(t, files, "HEAD", "/style.css")
+	assert.Contains(t, got, "Content-Length: 6\r\n")
+	assert.True(t, strings.HasSuffix(got, "\r\n\r\n"))
+
+	// Test: Directory listing
+	listing := FileServer(fsys, FileServerOptions{StripPrefix: "/static", ListDirectories: true})
+	got = serve(t, listing, "GET", "/static/docs/")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, got, "Content-Type: text/html; charset=utf-8\r\n")
+	assert.Contains(t, got, `<li><a href="../">../</a></li>`)
+	assert.Contains(t, got, `<li><a href="./a%20%3Cb%3E.txt">a &lt;b&gt;.txt</a></li>`)
+	assert.Contains(t, got, `<li><a href="./guide.html">guide.html</a></li>`)
+	assert.Contains(t, got, `<li><a href="./sub/">sub/</a></li>`)
+
+	// Test: Prefix
+	got = serve(t, listing, "GET", "/static/style.css")
+	assert.True(t, strings.HasSuffix(got, "\r\n\r\nbody{}"))
+	got = serve(t, listing, "GET", "/staticstyle.css")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 404 Not Found\r\n"))
+	got = serve(t, listing, "GET", "/style.css")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 404 Not Found\r\n"))
+
+	// Test: ServeFile
+	got = serve(t, func(w *response.Writer, r *request.Request) {
+		ServeFile(w, r, fsys, "docs/guide.html")
+	}, "GET", "/anything")
+	assert.True(t, strings.HasSuffix(got, "\r\n\r\n<p>guide</p>"))
+}
+
+func TestSniffContentType(t *testing.T) {
+	assert.Equal(t, "text/html; charset=utf-8", sniffContentType([]byte("  <!doctype html><p>")))
+	assert.Equal(t, "image/png", sniffContentType([]byte("\x89PNG\r\n\x1a\n....")))
+	assert.Equal(t, "video/mp4", sniffContentType([]byte("\x00\x00\x00\x20ftypisom")))
+	assert.Equal(t, "text/plain; charset=utf-8", sniffContentType([]byte("héllo\n")))
+	assert.Equal(t, "text/plain; charset=utf-8", sniffContentType(nil))
+	assert.Equal(t, "application/octet-stream", sniffContentType([]byte{0xff, 0x00, 0x10}))
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxRanges is how many ranges a Range header may ask for before it is
+// ignored and the whole content is sent instead.
+const maxRanges = 100
+
+// errNoOverlap is returned by parseRange when none of the requested ranges
+// overlap the content.
+var errNoOverlap = errors.New("no requested range overlaps the content")
+
+// httpRange is a byte range of content that is size bytes long.
+type httpRange struct {
+	start, length int64
+}
+
+func (r httpRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// parseRange parses a Range header (RFC 9110 §14.2) against content of the
+// given size. Ranges that start past the end are left out; if that leaves
+// none it returns errNoOverlap. A header that cannot be parsed or uses a
+// unit other than bytes returns a nil slice and no error, so that it is
+// ignored.
+func parseRange(s string, size int64) ([]httpRange, error) {
+	unit, set, ok := strings.Cut(s, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, nil
+	}
+	var ranges []httpRange
+	specs := strings.Split(set, ",")
+	if len(specs) > maxRanges {
+		return nil, nil
+	}
+	count := 0
+	for _, spec := range specs {
+		spec = strings.Trim(spec, " \t")
+		if spec == "" {
+			continue
+		}
+		count++
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, nil
+		}
+		if first == "" {
+			// suffix-range: the last n bytes
+			n, ok := parseDigits(last)
+			if !ok {
+				return nil, nil
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			n = min(n, size)
+			ranges = append(ranges, httpRange{start: size - n, length: n})
+			continue
+		}
+		start, ok := parseDigits(first)
+		if !ok {
+			return nil, nil
+		}
+		end := size - 1
+		if last != "" {
+			end, ok = parseDigits(last)
+			if !ok || end < start {
+				return nil, nil
+			}
+			end = min(end, size-1)
+		}
+		if start >= size {
+			continue
+		}
+		ranges = append(ranges, httpRange{start: start, length: end - start + 1})
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	if len(ranges) == 0 {
+		return nil, errNoOverlap
+	}
+	return ranges, nil
+}
+
+func parseDigits(s string) (int64, bool) {
+	if s == "" {
+		return 0, false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+// sumRangesSize returns the total number of bytes the ranges cover,
+// counting overlaps more than once.
+func sumRangesSize(ranges []httpRange) int64 {
+	var size int64
+	for _, r := range ranges {
+		size += r.length
+	}
+	return size
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iferdel-vault/tcptohttp/internal/request"
+	"github.com/iferdel-vault/tcptohttp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		size    int64
+		want    []httpRange
+		wantErr error
+	}{
+		{name: "first bytes", header: "bytes=0-4", size: 10, want: []httpRange{{0, 5}}},
+		{name: "open end", header: "bytes=5-", size: 10, want: []httpRange{{5, 5}}},
+		{name: "end past size", header: "bytes=5-100", size: 10, want: []httpRange{{5, 5}}},
+		{name: "suffix", header: "bytes=-3", size: 10, want: []httpRange{{7, 3}}},
+		{name: "suffix longer than content", header: "bytes=-30", size: 10, want: []httpRange{{0, 10}}},
+		{name: "several", header: "bytes=0-1, 4-5,-1", size: 10, want: []httpRange{{0, 2}, {4, 2}, {9, 1}}},
+		{name: "unit is case-insensitive", header: "Bytes=0-0", size: 10, want: []httpRange{{0, 1}}},
+		{name: "one past the end", header: "bytes=0-1,20-30", size: 10, want: []httpRange{{0, 2}}},
+		{name: "all past the end", header: "bytes=10-", size: 10, wantErr: errNoOverlap},
+		{name: "zero suffix", header: "bytes=-0", size: 10, wantErr: errNoOverlap},
+		{name: "empty content", header: "bytes=0-", size: 0, wantErr: errNoOverlap},
+		{name: "other unit", header: "items=0-1", size: 10},
+		{name: "end before start", header: "bytes=5-1", size: 10},
+		{name: "no dash", header: "bytes=5", size: 10},
+		{name: "sign", header: "bytes=+1-2", size: 10},
+		{name: "no ranges", header: "bytes=", size: 10},
+		{name: "no equals", header: "bytes 0-1", size: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRange(tt.header, tt.size)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestServeContent(t *testing.T) {
+	content := "0123456789"
+	modtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	handler := func(w *response.Writer, r *request.Request) {
+		ServeContent(w, r, "file.html", modtime, strings.NewReader(content))
+	}
+
+	// Test: No Range
+	got := serve(t, handler, "GET", "/")
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 10\r\n"+
+		"Content-Type: text/html; charset=utf-8\r\n"+
+		"Accept-Ranges: bytes\r\n"+
+		"ETag: W/\"a-17cb5b99f8638000\"\r\n"+
+		"Last-Modified: Wed, 01 May 2024 12:00:00 GMT\r\n"+
+		"\r\n"+
+		"0123456789", got)
+
+	// Test: Single range
+	got = serve(t, handler, "GET", "/", "Range: bytes=2-4")
+	assert.Equal(t, "HTTP/1.1 206 Partial Content\r\n"+
+		"Content-Length: 3\r\n"+
+		"Content-Type: text/html; charset=utf-8\r\n"+
+		"Accept-Ranges: bytes\r\n"+
+		"ETag: W/\"a-17cb5b99f8638000\"\r\n"+
+		"Last-Modified: Wed, 01 May 2024 12:00:00 GMT\r\n"+
+		"Content-Range: bytes 2-4/10\r\n"+
+		"\r\n"+
+		"234", got)
+
+	// Test: Suffix range
+	got = serve(t, handler, "GET", "/", "Range: bytes=-2")
+	assert.Contains(t, got, "Content-Range: bytes 8-9/10\r\n")
+	assert.True(t, strings.HasSuffix(got, "\r\n\r\n89"))
+
+	// Test: Several ranges
+	got = serve(t, handler, "GET", "/", "Range: bytes=0-1,5-6")
+	head, body, ok := strings.Cut(got, "\r\n\r\n")
+	require.True(t, ok)
+	assert.Contains(t, head, "HTTP/1.1 206 Partial Content\r\n")
+	_, boundary, ok := strings.Cut(head, "multipart/byteranges; boundary=")
+	require.True(t, ok)
+	boundary, _, _ = strings.Cut(boundary, "\r\n")
+	assert.Equal(t, "--"+boundary+"\r\n"+
+		"Content-Range: bytes 0-1/10\r\n"+
+		"Content-Type: text/html; charset=utf-8\r\n"+
+		"\r\n"+
+		"01\r\n"+
+		"--"+boundary+"\r\n"+
+		"Content-Range: bytes 5-6/10\r\n"+
+		"Content-Type: text/html; charset=utf-8\r\n"+
+		"\r\n"+
+		"56\r\n"+
+		"--"+boundary+"--\r\n", body)
+	assert.Contains(t, head, "Content-Length: "+strconv.Itoa(len(body))+"\r\n")
+
+	// Test: Unsatisfiable range
+	got = serve(t, handler, "GET", "/", "Range: bytes=20-")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 416 Range Not Satisfiable\r\n"))
+	assert.Contains(t, got, "Content-Range: bytes */10\r\n")
+
+	// Test: Invalid Range is ignored
+	got = serve(t, handler, "GET", "/", "Range: bytes=5-1")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 200 OK\r\n"))
+
+	// Test: Overlapping ranges adding up past the size are ignored
+	got = serve(t, handler, "GET", "/", "Range: bytes=0-,0-,0-")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 200 OK\r\n"))
+
+	// Test: Range is ignored for HEAD
+	got = serve(t, handler, "HEAD", "/", "Range: bytes=0-1")
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 10\r\n"+
+		"Content-Type: text/html; charset=utf-8\r\n"+
+		"Accept-Ranges: bytes\r\n"+
+		"ETag: W/\"a-17cb5b99f8638000\"\r\n"+
+		"Last-Modified: Wed, 01 May 2024 12:00:00 GMT\r\n"+
+		"\r\n", got)
+
+	// Test: If-Range with the current date
+	got = serve(t, handler, "GET", "/", "Range: bytes=0-1", "If-Range: Wed, 01 May 2024 12:00:00 GMT")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 206 Partial Content\r\n"))
+
+	// Test: If-Range with an old date sends everything
+	got = serve(t, handler, "GET", "/", "Range: bytes=0-1", "If-Range: Tue, 30 Apr 2024 12:00:00 GMT")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 200 OK\r\n"))
+
+	// Test: If-Range with an entity-tag and no ETag sends everything
+	got = serve(t, handler, "GET", "/", "Range: bytes=0-1", "If-Range: \"abc\"")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 200 OK\r\n"))
+}
@@ -1,25 +1,58 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/iferdel-vault/tcptohttp/internal/headers"
 	"github.com/iferdel-vault/tcptohttp/internal/request"
 	"github.com/iferdel-vault/tcptohttp/internal/response"
 )
 
+// maxDrainBytes is how much of an unread request body the server will skip
+// to keep a connection alive.
+const maxDrainBytes = 256 << 10
+
+// closeLinger is how long a closing connection keeps reading what the client
+// still sends, see closeConn.
+const closeLinger = 500 * time.Millisecond
+
 type Handler func(w *response.Writer, r *request.Request)
 
+// connState tells whether a connection is waiting for a request or serving
+// one.
+type connState int
+
+const (
+	stateIdle connState = iota
+	stateActive
+)
+
 // Server is an HTTP 1.1 server
 type Server struct {
 	listener net.Listener
 	isClosed atomic.Bool
 	handler  func(w *response.Writer, r *request.Request)
+	limits   request.Limits
+
+	mu    sync.Mutex
+	conns map[net.Conn]connState
+	wg    sync.WaitGroup
 }
 
 func Serve(port int, handler Handler) (*Server, error) {
+	return ServeWithLimits(port, handler, request.DefaultLimits)
+}
+
+// ServeWithLimits is like Serve but rejects requests that go over limits.
+func ServeWithLimits(port int, handler Handler, limits request.Limits) (*Server, error) {
 	portStr := strconv.Itoa(port)
 	listener, err := net.Listen("tcp", "127.0.0.1:"+portStr)
 	if err != nil {
@@ -28,6 +61,7 @@ func Serve(port int, handler Handler) (*Server, error) {
 	s := &Server{
 		listener: listener,
 		handler:  handler,
+		limits:   limits,
 	}
 	go s.listen()
 	return s, nil
@@ -41,6 +75,93 @@ func (s *Server) Close() error {
 	return nil
 }
 
+// Shutdown stops accepting connections, closes the idle ones and waits for
+// the requests in flight to finish. Their responses ask the client to close
+// the connection. If ctx is done first, the remaining connections are
+// closed and Shutdown returns the context's error.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.isClosed.Store(true)
+	for conn, state := range s.conns {
+		if state == stateIdle {
+			conn.Close()
+		}
+	}
+	s.mu.Unlock()
+
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// trackConn registers a new connection, unless the server is shutting down.
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isClosed.Load() {
+		return false
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]connState)
+	}
+	s.conns[conn] = stateIdle
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// setState records what a connection is doing. It reports false for a
+// connection going idle once the server is shutting down, which should
+// then be closed.
+func (s *Server) setState(conn net.Conn, state connState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state == stateIdle && s.isClosed.Load() {
+		return false
+	}
+	s.conns[conn] = state
+	return true
+}
+
+// stateConn marks its connection active as soon as a read returns bytes of
+// a request, so Shutdown leaves alone a request that is still arriving.
+type stateConn struct {
+	net.Conn
+	s *Server
+}
+
+func (c stateConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.s.setState(c.Conn, stateActive)
+	}
+	return n, err
+}
+
 func (s *Server) listen() {
 	for {
 		conn, err := s.listener.Accept()
@@ -51,20 +172,119 @@ func (s *Server) listen() {
 			fmt.Println("error in listen", err)
 			continue
 		}
+		if !s.trackConn(conn) {
+			conn.Close()
+			return
+		}
 		go s.handle(conn)
 	}
 }
 
 func (s *Server) handle(conn net.Conn) {
-	defer conn.Close()
-	w := response.NewWriter(conn)
-	req, err := request.RequestFromReader(conn)
-	if err != nil {
-		w.WriteStatusLine(response.StatusBadRequest)
-		body := []byte(fmt.Sprintf("Error parsing request: %v", err))
-		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
-		w.WriteBody(body)
-		return
+	defer s.untrackConn(conn)
+	defer closeConn(conn)
+	rr := request.NewReader(stateConn{Conn: conn, s: s})
+	rr.Limits = s.limits
+	for {
+		// a pipelined request already buffered is in flight
+		state := stateIdle
+		if rr.Buffered() > 0 {
+			state = stateActive
+		}
+		if !s.setState(conn, state) {
+			return
+		}
+		w := response.NewWriter(conn)
+		req, err := rr.ReadRequest()
+		s.setState(conn, stateActive)
+		if err != nil {
+			// a closed connection is Shutdown dropping an idle one
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			writeError(w, statusForError(err), fmt.Sprintf("Error parsing request: %v", err))
+			return
+		}
+		w.SetHttpVersion(req.RequestLine.HttpVersion)
+		w.SetKeepAlive(req.KeepAlive() && !s.isClosed.Load())
+		w.SetHead(req.RequestLine.Method == "HEAD")
+
+		expect, ok := req.Headers.Get("Expect")
+		if ok && !req.ExpectsContinue() && req.RequestLine.HttpVersion != "1.0" {
+			writeError(w, response.StatusExpectationFailed, fmt.Sprintf("Unsupported expectation: %s", expect))
+			return
+		}
+		if req.ExpectsContinue() {
+			w.ExpectContinue()
+			req.SetContinue(w.WriteContinue)
+		}
+		// a body left unread must be skipped before the next request; if it
+		// is known to be too long for that, the response closes the
+		// connection. A chunked body can only be tried.
+		w.SetKeepAliveCheck(func() bool {
+			return req.UnreadBodyLength() <= maxDrainBytes
+		})
+		s.handler(w, req)
+		if req.MultipartForm != nil {
+			// FormValue and FormFile can spill file parts to disk without
+			// the handler knowing
+			req.MultipartForm.RemoveAll()
+		}
+		if s.isClosed.Load() {
+			// Shutdown began during the handler; headers not sent yet can
+			// still tell the client to close
+			w.SetKeepAlive(false)
+		}
+		// an error here includes a body shorter than its Content-Length,
+		// after which the connection is out of step with the client
+		err = w.Finish()
+		if err != nil || !w.KeepAlive() {
+			return
+		}
+
+		// skip whatever the handler left of the body, closed or not, so the
+		// next request starts at the right place
+		if !req.DiscardBody(maxDrainBytes) {
+			return
+		}
+		req.BodyReader.Close()
+	}
+}
+
+// writeError answers with a plain text error and closes the connection
+// after it.
+func writeError(w *response.Writer, statusCode response.StatusCode, message string) {
+	w.SetKeepAlive(false)
+	w.WriteStatusLine(statusCode)
+	body := []byte(message)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+	w.Finish()
+}
+
+// closeConn closes conn once the client has had a chance to read the last
+// response. Closing a socket with unread request bytes, such as the rest
+// of a request rejected as too large, makes the kernel reset the
+// connection, and the client may lose the response with it.
+func closeConn(conn net.Conn) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.CloseWrite()
+		tcpConn.SetReadDeadline(time.Now().Add(closeLinger))
+		io.CopyN(io.Discard, tcpConn, maxDrainBytes)
+	}
+	conn.Close()
+}
+
+// statusForError picks the response status for a request that could not be
+// parsed.
+func statusForError(err error) response.StatusCode {
+	var requestErr *request.Error
+	if errors.As(err, &requestErr) {
+		return response.StatusCode(requestErr.StatusCode)
+	}
+	var headersErr *headers.Error
+	if errors.As(err, &headersErr) {
+		return response.StatusCode(headersErr.StatusCode)
 	}
-	s.handler(w, req)
+	return response.StatusBadRequest
 }
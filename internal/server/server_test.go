@@ -0,0 +1,421 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iferdel-vault/tcptohttp/internal/request"
+	"github.com/iferdel-vault/tcptohttp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingServer starts a server whose handler waits on release before
+// answering.
+func blockingServer(t *testing.T) (s *Server, started chan struct{}, release chan struct{}) {
+	t.Helper()
+	started = make(chan struct{}, 1)
+	release = make(chan struct{})
+	s, err := Serve(0, func(w *response.Writer, r *request.Request) {
+		started <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("done"))
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s, started, release
+}
+
+func dial(t *testing.T, s *Server) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// exchange sends raw to a server running handler and returns everything it
+// answers until it closes the connection.
+func exchange(t *testing.T, handler Handler, raw string) string {
+	t.Helper()
+	return exchangeWithLimits(t, handler, request.DefaultLimits, raw)
+}
+
+func exchangeWithLimits(t *testing.T, handler Handler, limits request.Limits, raw string) string {
+	t.Helper()
+	s, err := ServeWithLimits(0, handler, limits)
+	require.NoError(t, err)
+	defer s.Close()
+	conn := dial(t, s)
+	_, err = io.WriteString(conn, raw)
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	got, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(got)
+}
+
+// reply is the part of a response the server tests look at.
+type reply struct {
+	status int
+	close  bool
+	body   string
+}
+
+// readReplies parses the responses to GET or POST requests in raw.
+func readReplies(t *testing.T, raw string) []reply {
+	t.Helper()
+	br := bufio.NewReader(strings.NewReader(raw))
+	var replies []reply
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			return replies
+		}
+		resp, err := http.ReadResponse(br, nil)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		replies = append(replies, reply{status: resp.StatusCode, close: resp.Close, body: string(body)})
+	}
+}
+
+func echoTarget(w *response.Writer, r *request.Request) {
+	body := []byte(r.RequestLine.RequestTarget)
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+// serve runs handler for a request with the given method and target, plus
+// any extra header lines such as "Range: bytes=0-1", and returns the
+// response it writes.
+func serve(t *testing.T, handler Handler, method, target string, header ...string) string {
+	t.Helper()
+	raw := method + " " + target + " HTTP/1.1\r\nHost: x\r\n"
+	for _, line := range header {
+		raw += line + "\r\n"
+	}
+	r, err := request.RequestFromReader(strings.NewReader(raw + "\r\n"))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w := response.NewWriter(&buf)
+	w.SetHead(method == "HEAD")
+	handler(w, r)
+	require.NoError(t, w.Finish())
+	return buf.String()
+}
+
+func TestServeKeepAlive(t *testing.T) {
+	// Test: Pipelined requests are answered in order
+	got := exchange(t, echoTarget,
+		"GET /a HTTP/1.1\r\nHost: x\r\n\r\n"+
+			"GET /b HTTP/1.1\r\nHost: x\r\n\r\n"+
+			"GET /c HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n")
+	assert.Equal(t, []reply{
+		{status: 200, body: "/a"},
+		{status: 200, body: "/b"},
+		{status: 200, close: true, body: "/c"},
+	}, readReplies(t, got))
+
+	// Test: Bodies left unread are skipped, even once closed
+	got = exchange(t, func(w *response.Writer, r *request.Request) {
+		defer r.BodyReader.Close()
+		echoTarget(w, r)
+	},
+		"POST /a HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\n\r\nhello"+
+			"POST /b HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"+
+			"POST /c HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nConnection: close\r\n\r\nhello")
+	assert.Equal(t, []reply{
+		{status: 200, body: "/a"},
+		{status: 200, body: "/b"},
+		{status: 200, close: true, body: "/c"},
+	}, readReplies(t, got))
+
+	// Test: A body too large to skip closes the connection in the response
+	got = exchange(t, echoTarget,
+		"POST /a HTTP/1.1\r\nHost: x\r\nContent-Length: 1000000\r\n\r\n")
+	assert.Equal(t, []reply{{status: 200, close: true, body: "/a"}}, readReplies(t, got))
+
+	// Test: A body read by the handler keeps the connection
+	got = exchange(t, func(w *response.Writer, r *request.Request) {
+		body, _ := io.ReadAll(r.BodyReader)
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	},
+		"POST / HTTP/1.1\r\nHost: x\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nhi\r\n0\r\n\r\n"+
+			"POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 3\r\nConnection: close\r\n\r\nbye")
+	assert.Equal(t, []reply{
+		{status: 200, body: "hi"},
+		{status: 200, close: true, body: "bye"},
+	}, readReplies(t, got))
+}
+
+func TestServeLimits(t *testing.T) {
+	limits := request.Limits{
+		MaxRequestLineBytes: 64,
+		MaxHeaderBytes:      256,
+		MaxHeaderCount:      4,
+		MaxBodyBytes:        16,
+	}
+	tests := []struct {
+		name       string
+		raw        string
+		wantStatus int
+	}{
+		{
+			name:       "request-line too long",
+			raw:        "GET /" + strings.Repeat("a", 100) + " HTTP/1.1\r\nHost: x\r\n\r\n",
+			wantStatus: 414,
+		},
+		{
+			name:       "too many header fields",
+			raw:        "GET / HTTP/1.1\r\nHost: x\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n",
+			wantStatus: 431,
+		},
+		{
+			name:       "header section too large",
+			raw:        "GET / HTTP/1.1\r\nHost: x\r\nX-Big: " + strings.Repeat("b", 300) + "\r\n\r\n",
+			wantStatus: 431,
+		},
+		{
+			name:       "body too large",
+			raw:        "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 17\r\n\r\n",
+			wantStatus: 413,
+		},
+		{
+			name:       "within limits",
+			raw:        "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 16\r\nConnection: close\r\n\r\n" + strings.Repeat("c", 16),
+			wantStatus: 200,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// exchange only returns once the server closes the connection
+			got := exchangeWithLimits(t, echoTarget, limits, tt.raw)
+			replies := readReplies(t, got)
+			require.Len(t, replies, 1)
+			assert.Equal(t, tt.wantStatus, replies[0].status)
+			assert.True(t, replies[0].close)
+		})
+	}
+}
+
+func TestServeVersions(t *testing.T) {
+	// Test: A major version other than 1 gets a 505
+	got := exchange(t, echoTarget, "GET / HTTP/2.0\r\nHost: x\r\n\r\n")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 505 "), got)
+	replies := readReplies(t, got)
+	require.Len(t, replies, 1)
+	assert.Equal(t, 505, replies[0].status)
+	assert.True(t, replies[0].close)
+
+	// Test: A later HTTP/1.x minor version is answered as HTTP/1.1
+	got = exchange(t, echoTarget, "GET /a HTTP/1.2\r\nHost: x\r\nConnection: close\r\n\r\n")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.1 200 OK\r\n"), got)
+	assert.Equal(t, []reply{{status: 200, close: true, body: "/a"}}, readReplies(t, got))
+
+	// Test: HTTP/1.0 closes unless asked to keep the connection
+	got = exchange(t, echoTarget, "GET /a HTTP/1.0\r\n\r\n")
+	assert.True(t, strings.HasPrefix(got, "HTTP/1.0 200 OK\r\n"), got)
+	assert.Equal(t, []reply{{status: 200, close: true, body: "/a"}}, readReplies(t, got))
+}
+
+func TestServeExpectContinue(t *testing.T) {
+	echoBody := func(w *response.Writer, r *request.Request) {
+		body, err := io.ReadAll(r.BodyReader)
+		if !assert.NoError(t, err) {
+			return
+		}
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}
+
+	// Test: 100 Continue once the handler reads the body
+	s, err := Serve(0, echoBody)
+	require.NoError(t, err)
+	defer s.Close()
+	conn := dial(t, s)
+	conn.SetDeadline(time.Now().Add(time.Second))
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	require.NoError(t, err)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 100, resp.StatusCode)
+	_, err = io.WriteString(conn, "hello")
+	require.NoError(t, err)
+	resp, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+	assert.False(t, resp.Close)
+
+	// Test: No 100 Continue when the handler answers without the body
+	got := exchange(t, echoTarget, "POST /a HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+	assert.NotContains(t, got, "100 Continue")
+	assert.Equal(t, []reply{{status: 200, close: true, body: "/a"}}, readReplies(t, got))
+
+	// Test: Unknown expectations get a 417
+	got = exchange(t, echoBody, "POST / HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nExpect: something-else\r\n\r\n")
+	replies := readReplies(t, got)
+	require.Len(t, replies, 1)
+	assert.Equal(t, 417, replies[0].status)
+	assert.True(t, replies[0].close)
+}
+
+func TestServeRemovesMultipartFiles(t *testing.T) {
+	body := "--XyZ\r\n" +
+		"Content-Disposition: form-data; name=\"upload\"; filename=\"big.bin\"\r\n" +
+		"\r\n" +
+		strings.Repeat("x", 5000) + "\r\n" +
+		"--XyZ--\r\n"
+	var tmpfile string
+	got := exchange(t, func(w *response.Writer, r *request.Request) {
+		err := r.ParseMultipartForm(1024)
+		if !assert.NoError(t, err) {
+			return
+		}
+		f, err := r.MultipartForm.File["upload"][0].Open()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer f.Close()
+		if osFile, ok := f.(*os.File); assert.True(t, ok, "file part was not written to disk") {
+			tmpfile = osFile.Name()
+		}
+		echoTarget(w, r)
+	}, "POST /a HTTP/1.1\r\nHost: x\r\nConnection: close\r\n"+
+		"Content-Type: multipart/form-data; boundary=XyZ\r\n"+
+		"Content-Length: "+strconv.Itoa(len(body))+"\r\n\r\n"+body)
+	assert.Equal(t, []reply{{status: 200, close: true, body: "/a"}}, readReplies(t, got))
+	require.NotEmpty(t, tmpfile)
+	_, err := os.Stat(tmpfile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestServeHead(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		headers string
+	}{
+		{
+			name:    "buffered body",
+			body:    "hello",
+			headers: "Content-Length: 5\r\nContent-Type: text/plain\r\n",
+		},
+		{
+			name:    "streamed body",
+			body:    strings.Repeat("x", 10000),
+			headers: "Transfer-Encoding: chunked\r\nContent-Type: text/plain\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := exchange(t, func(w *response.Writer, r *request.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte(tt.body))
+			},
+				"HEAD / HTTP/1.1\r\nHost: x\r\n\r\n"+
+					"GET / HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n")
+			head := "HTTP/1.1 200 OK\r\n" + tt.headers + "\r\n"
+			require.True(t, strings.HasPrefix(got, head), got)
+			replies := readReplies(t, got[len(head):])
+			require.Len(t, replies, 1)
+			assert.Equal(t, reply{status: 200, close: true, body: tt.body}, replies[0])
+		})
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	// Test: Active requests finish, idle connections are closed
+	s, started, release := blockingServer(t)
+	idle := dial(t, s)
+	active := dial(t, s)
+	_, err := io.WriteString(active, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	shutdownErr := make(chan error)
+	go func() { shutdownErr <- s.Shutdown(context.Background()) }()
+
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = idle.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returned before the request finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	_, err = net.Dial("tcp", s.listener.Addr().String())
+	assert.Error(t, err)
+
+	close(release)
+	require.NoError(t, <-shutdownErr)
+	got, err := io.ReadAll(active)
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 4\r\nContent-Type: text/plain\r\nConnection: close\r\n\r\ndone", string(got))
+
+	// Test: Connections still active at the deadline are closed
+	s, started, release = blockingServer(t)
+	defer close(release)
+	active = dial(t, s)
+	_, err = io.WriteString(active, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = s.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	active.SetReadDeadline(time.Now().Add(time.Second))
+	got, err = io.ReadAll(active)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestShutdownDuringRequest(t *testing.T) {
+	// Test: A connection is active from the first byte of a request
+	s, err := Serve(0, echoTarget)
+	require.NoError(t, err)
+	defer s.Close()
+	conn := dial(t, s)
+	_, err = io.WriteString(conn, "GET /a HTTP/1.1\r\n")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, state := range s.conns {
+			if state == stateActive {
+				return true
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond)
+
+	shutdownErr := make(chan error)
+	go func() { shutdownErr <- s.Shutdown(context.Background()) }()
+	_, err = io.WriteString(conn, "Host: x\r\n\r\n")
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	got, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, []reply{{status: 200, close: true, body: "/a"}}, readReplies(t, string(got)))
+	conn.Close()
+	require.NoError(t, <-shutdownErr)
+}
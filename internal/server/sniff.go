@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// sniffLen is how many leading bytes sniffContentType looks at.
+const sniffLen = 512
+
+// signature is a byte pattern at a fixed offset that identifies a type.
+type signature struct {
+	offset int
+	prefix []byte
+	ctype  string
+}
+
+var signatures = []signature{
+	{0, []byte("%PDF-"), "application/pdf"},
+	{0, []byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	{0, []byte("\xff\xd8\xff"), "image/jpeg"},
+	{0, []byte("GIF87a"), "image/gif"},
+	{0, []byte("GIF89a"), "image/gif"},
+	{8, []byte("WEBP"), "image/webp"},
+	{4, []byte("ftyp"), "video/mp4"},
+	{0, []byte("\x1a\x45\xdf\xa3"), "video/webm"},
+	{0, []byte("ID3"), "audio/mpeg"},
+	{0, []byte("OggS\x00"), "application/ogg"},
+	{0, []byte("PK\x03\x04"), "application/zip"},
+	{0, []byte("\x1f\x8b\x08"), "application/x-gzip"},
+	{0, []byte("\x00asm"), "application/wasm"},
+}
+
+// htmlPrefixes start an HTML document once leading whitespace is skipped;
+// they are matched case-insensitively.
+var htmlPrefixes = [][]byte{
+	[]byte("<!DOCTYPE HTML"),
+	[]byte("<HTML"),
+	[]byte("<HEAD"),
+	[]byte("<BODY"),
+	[]byte("<SCRIPT"),
+	[]byte("<TITLE"),
+	[]byte("<!--"),
+}
+
+// sniffContentType guesses the media type of content from its first bytes,
+// for files whose name has no known extension. It knows a few common binary
+// signatures and HTML, and falls back to text/plain for UTF-8 without
+// control characters and to application/octet-stream for anything else.
+func sniffContentType(data []byte) string {
+	data = data[:min(len(data), sniffLen)]
+	for _, sig := range signatures {
+		if len(data) >= sig.offset+len(sig.prefix) && bytes.Equal(data[sig.offset:sig.offset+len(sig.prefix)], sig.prefix) {
+			return sig.ctype
+		}
+	}
+	trimmed := bytes.TrimLeft(data, "\t\n\x0c\r ")
+	for _, prefix := range htmlPrefixes {
+		if len(trimmed) >= len(prefix) && bytes.EqualFold(trimmed[:len(prefix)], prefix) {
+			return "text/html; charset=utf-8"
+		}
+	}
+	if isText(data) {
+		return "text/plain; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
+
+func isText(data []byte) bool {
+	for i := 0; i < len(data); {
+		c := data[i]
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != 0x0c && c != 0x1b {
+			return false
+		}
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			// a rune cut off by the sniffing limit is still text
+			return len(data)-i < utf8.UTFMax && len(data) == sniffLen
+		}
+		i += size
+	}
+	return true
+}